@@ -0,0 +1,35 @@
+package pgmigrate
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// analyze runs ANALYZE, or VACUUM ANALYZE with AnalyzeVacuum, on the
+// comma-separated tables of an analyze directive:
+//
+//	-- pgmigrate:analyze orders, order_items
+//
+// It runs after the migration committed since VACUUM can't run in a
+// transaction. Failures are logged as warnings unless AnalyzeStrict is set.
+func (m *Migrator) analyze(ctx context.Context, db *sqlx.DB, id, tables string) error {
+	command := "ANALYZE "
+	if m.AnalyzeVacuum {
+		command = "VACUUM ANALYZE "
+	}
+	for _, table := range strings.Split(tables, ",") {
+		table = strings.TrimSpace(table)
+		if table == "" {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, command+table); err != nil {
+			if m.AnalyzeStrict {
+				return migrationError(StageExec, id, err)
+			}
+			m.logf("warning: migration %s: %s%s failed: %v", id, command, table, err)
+		}
+	}
+	return nil
+}
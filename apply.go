@@ -0,0 +1,321 @@
+package pgmigrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TrackingOrder decides when a migration is recorded in the migrations table
+// relative to running its SQL.
+//
+// Transactional migrations commit their SQL and their tracking row together,
+// so the order makes no difference. Migrations with the header
+//
+//	-- pgmigrate: no-transaction: true
+//
+// run each statement on its own, outside a transaction (as CREATE INDEX
+// CONCURRENTLY requires), and a crash between the SQL and the tracking row
+// leaves them half done. The order picks which way they are left.
+type TrackingOrder int
+
+const (
+	// TrackAfter records a migration once its SQL succeeded. A crash in
+	// between leaves it applied but not recorded: it runs again on the next
+	// run (at-least-once), so its SQL should be idempotent.
+	TrackAfter TrackingOrder = iota
+	// TrackBefore records a migration before its SQL runs. A crash or failure
+	// in between leaves it recorded but not (fully) applied: it never runs
+	// twice (at-most-once) and has to be completed by hand.
+	TrackBefore
+)
+
+// apply runs the pending migration in file and records it as id
+func (m *Migrator) apply(ctx context.Context, db *sqlx.DB, file, id, runID string) (result Result, err error) {
+	ctx, span := m.startSpan(ctx, "pgmigrate.migration")
+	span.SetAttribute("migration.id", id)
+	defer func() {
+		if err == nil {
+			span.SetAttribute("migration.state", result.State.String())
+		}
+		span.End(err)
+	}()
+	// read once: the bytes hashed below are exactly the bytes executed
+	fcontent, err := m.readMigration(file)
+	if err != nil {
+		return Result{}, migrationError(StageRead, id, err)
+	}
+	if m.plan != nil {
+		if err := m.checkPlanned(id, fcontent); err != nil {
+			return Result{}, migrationError(StageVerify, id, err)
+		}
+	}
+	header, err := ParseMigrationHeader(fcontent)
+	if err != nil {
+		return Result{}, migrationError(StageRead, id, err)
+	}
+	if m.WarnUnterminated && unterminated(m.upSQL(fcontent)) {
+		m.logf("warning: migration %s: last statement has no semicolon, is the file truncated?", id)
+	}
+	if err := m.checkDependsOn(ctx, db, id, header.DependsOn); err != nil {
+		return Result{}, migrationError(StageVerify, id, err)
+	}
+	if err := m.renewLock(ctx, db); err != nil {
+		return Result{}, migrationError(StageLock, id, err)
+	}
+	if err := m.labelSession(ctx, db, id); err != nil {
+		return Result{}, migrationError(StageExec, id, err)
+	}
+	// repeatable migrations run on every run and are not tracked
+	track := !m.isRepeatable(file)
+	list, err := phases(m.upSQL(fcontent))
+	if err != nil {
+		return Result{}, migrationError(StageRead, id, err)
+	}
+	if m.SplitStatements || header.NoTransaction || list != nil {
+		if err := checkStatementLimit(m.upSQL(fcontent), m.MaxStatements); err != nil {
+			return Result{}, migrationError(StageRead, id, err)
+		}
+	}
+	if m.PoolerSafe && (header.NoTransaction || list != nil) && (header.Role != "" || header.LockTimeout > 0) {
+		return Result{}, migrationError(StageRead, id, errors.New("role and lock-timeout headers need a transaction with PoolerSafe"))
+	}
+	if list != nil {
+		result, err = m.applyPhases(ctx, db, id, fcontent, header, list, runID, track)
+	} else if header.NoTransaction {
+		result, err = m.applyWithoutTx(ctx, db, id, fcontent, header, runID, track)
+	} else {
+		result, err = m.applyInTx(ctx, db, id, fcontent, header, runID, track)
+	}
+	if err != nil || (result.State != StateApplied && result.State != StateRepeated) {
+		return result, err
+	}
+	if len(header.Analyze) > 0 {
+		if err := m.analyze(ctx, db, id, strings.Join(header.Analyze, ",")); err != nil {
+			return result, err
+		}
+	}
+	if m.AfterMigration != nil {
+		if err := m.AfterMigration(ctx, result); err != nil {
+			return result, migrationError(StageExec, id, err)
+		}
+	}
+	return result, nil
+}
+
+// checkStatementLimit fails when sql holds more than max statements, 0
+// meaning no limit: see MaxStatements
+func checkStatementLimit(sql string, max int) error {
+	if max <= 0 {
+		return nil
+	}
+	if n := len(splitStatements(sql)); n > max {
+		return fmt.Errorf("%d statements, more than MaxStatements (%d)", n, max)
+	}
+	return nil
+}
+
+// applyInTx runs a migration and records it in a single transaction
+func (m *Migrator) applyInTx(ctx context.Context, db *sqlx.DB, id string, content []byte, header MigrationHeader, runID string, track bool) (Result, error) {
+	txn, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: header.Isolation})
+	if err != nil {
+		return Result{}, migrationError(StageExec, id, err)
+	}
+	m.setActiveTx(db, txn)
+	defer m.setActiveTx(db, nil)
+	if err := m.setLocalSession(ctx, txn); err != nil {
+		txn.Rollback()
+		return Result{}, migrationError(StageExec, id, err)
+	}
+	if _, err := setHeaderSettings(ctx, txn, header, true); err != nil {
+		txn.Rollback()
+		return Result{}, migrationError(StageExec, id, err)
+	}
+	if m.BeforeMigration != nil {
+		if err := m.BeforeMigration(ctx, txn, id); err != nil {
+			txn.Rollback()
+			return Result{}, migrationError(StageExec, id, err)
+		}
+	}
+	if state, unmet, err := checkConditions(ctx, txn, header); err != nil || unmet {
+		// not recorded so it is evaluated again on the next run
+		txn.Rollback()
+		if err != nil {
+			return Result{}, migrationError(StageExec, id, err)
+		}
+		return Result{ID: id, State: state}, nil
+	}
+	if track && m.TrackingOrder == TrackBefore {
+		if err := m.record(ctx, txn, id, content, runID); err != nil {
+			txn.Rollback()
+			return Result{}, migrationError(StageTrack, id, err)
+		}
+	}
+	start := time.Now()
+	rows, err := m.execSQL(ctx, txn, m.upSQL(content), m.SplitStatements)
+	if err != nil {
+		txn.Rollback()
+		return Result{}, migrationError(StageExec, id, err)
+	}
+	if !track {
+		if err := txn.Commit(); err != nil {
+			return Result{}, migrationError(StageExec, id, err)
+		}
+		return Result{ID: id, State: StateRepeated, RowsAffected: rows}, nil
+	}
+	if err := m.recordDone(ctx, txn, id, content, runID, time.Since(start)); err != nil {
+		txn.Rollback()
+		return Result{}, migrationError(StageTrack, id, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return Result{}, migrationError(StageTrack, id, err)
+	}
+	return Result{ID: id, State: StateApplied, RowsAffected: rows}, nil
+}
+
+// applyWithoutTx runs the statements of a no-transaction migration one at a
+// time in autocommit mode. BeforeMigration is called with a nil transaction.
+// The isolation header has no effect without a transaction.
+func (m *Migrator) applyWithoutTx(ctx context.Context, db *sqlx.DB, id string, content []byte, header MigrationHeader, runID string, track bool) (Result, error) {
+	restore, err := setHeaderSettings(ctx, db, header, false)
+	if err != nil {
+		return Result{}, migrationError(StageExec, id, err)
+	}
+	defer restore()
+	if m.BeforeMigration != nil {
+		if err := m.BeforeMigration(ctx, nil, id); err != nil {
+			return Result{}, migrationError(StageExec, id, err)
+		}
+	}
+	state, unmet, err := checkConditions(ctx, db, header)
+	if err != nil {
+		return Result{}, migrationError(StageExec, id, err)
+	}
+	if unmet {
+		return Result{ID: id, State: state}, nil
+	}
+	if track && m.TrackingOrder == TrackBefore {
+		if err := m.record(ctx, db, id, content, runID); err != nil {
+			return Result{}, migrationError(StageTrack, id, err)
+		}
+	}
+	start := time.Now()
+	rows, err := m.execSQL(ctx, db, m.upSQL(content), true)
+	if err != nil {
+		return Result{}, migrationError(StageExec, id, err)
+	}
+	if !track {
+		return Result{ID: id, State: StateRepeated, RowsAffected: rows}, nil
+	}
+	if err := m.recordDone(ctx, db, id, content, runID, time.Since(start)); err != nil {
+		return Result{}, migrationError(StageTrack, id, err)
+	}
+	return Result{ID: id, State: StateApplied, RowsAffected: rows}, nil
+}
+
+// setHeaderSettings applies the role and lock-timeout headers of a migration
+// with set_config: until the end of the transaction when local is set, else
+// for the session. The returned function puts back the previous values the
+// same way, for migrations sharing a transaction or a session with others.
+func setHeaderSettings(ctx context.Context, e sqlx.ExtContext, header MigrationHeader, local bool) (func(), error) {
+	var settings [][2]string
+	if header.Role != "" {
+		settings = append(settings, [2]string{"role", header.Role})
+	}
+	if header.LockTimeout > 0 {
+		settings = append(settings, [2]string{"lock_timeout", fmt.Sprintf("%dms", header.LockTimeout.Milliseconds())})
+	}
+	var previous [][2]string
+	restore := func() {
+		for i := len(previous) - 1; i >= 0; i-- {
+			e.ExecContext(ctx, "SELECT set_config($1, $2, $3)", previous[i][0], previous[i][1], local)
+		}
+	}
+	for _, s := range settings {
+		var prev string
+		if err := e.QueryRowxContext(ctx, "SELECT current_setting($1)", s[0]).Scan(&prev); err != nil {
+			restore()
+			return func() {}, err
+		}
+		if _, err := e.ExecContext(ctx, "SELECT set_config($1, $2, $3)", s[0], s[1], local); err != nil {
+			restore()
+			return func() {}, fmt.Errorf("set %s: %w", s[0], err)
+		}
+		previous = append(previous, [2]string{s[0], prev})
+	}
+	return restore, nil
+}
+
+// record inserts the tracking row of a migration about to run
+func (m *Migrator) record(ctx context.Context, e sqlx.ExecerContext, id string, content []byte, runID string) error {
+	_, err := e.ExecContext(ctx, "INSERT INTO "+m.Table+
+		" (id, checksum, applied_at, applied_by, run_id, release_id) VALUES ($1, $2, now(), current_user, $3, $4)",
+		id, checksum(content), runID, m.releaseID())
+	return err
+}
+
+// recordDone records a migration whose SQL ran in duration: it completes
+// the row inserted by record with TrackBefore, or inserts it with TrackAfter
+func (m *Migrator) recordDone(ctx context.Context, e sqlx.ExecerContext, id string, content []byte, runID string, duration time.Duration) error {
+	if m.TrackingOrder == TrackBefore {
+		_, err := e.ExecContext(ctx, "UPDATE "+m.Table+" SET duration_ms = $2 WHERE id = $1", id, duration.Milliseconds())
+		return err
+	}
+	_, err := e.ExecContext(ctx, "INSERT INTO "+m.Table+
+		" (id, checksum, applied_at, duration_ms, applied_by, run_id, release_id) VALUES ($1, $2, now(), $3, current_user, $4, $5)",
+		id, checksum(content), duration.Milliseconds(), runID, m.releaseID())
+	return err
+}
+
+// releaseID returns ReleaseID, NULL when unset
+func (m *Migrator) releaseID() sql.NullString {
+	return sql.NullString{String: m.ReleaseID, Valid: m.ReleaseID != ""}
+}
+
+// checkConditions evaluates the precondition and if headers of a migration.
+// unmet is true when one of them doesn't hold, with the state of the
+// skipped migration.
+func checkConditions(ctx context.Context, q sqlx.QueryerContext, header MigrationHeader) (state State, unmet bool, err error) {
+	if header.Precondition != "" {
+		ok, err := checkPrecondition(ctx, q, header.Precondition)
+		if err != nil {
+			return 0, false, fmt.Errorf("precondition: %w", err)
+		}
+		if !ok {
+			return StatePreconditionUnmet, true, nil
+		}
+	}
+	if header.Condition != "" {
+		// a NULL condition, e.g. of an unset setting, doesn't hold
+		ok, err := checkPrecondition(ctx, q, "SELECT coalesce(("+header.Condition+")::boolean, false)")
+		if err != nil {
+			return 0, false, fmt.Errorf("if: %w", err)
+		}
+		if !ok {
+			return StateConditionFalse, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// checkPrecondition runs query and interprets its single boolean or integer
+// result; zero and false mean the precondition does not hold
+func checkPrecondition(ctx context.Context, q sqlx.QueryerContext, query string) (bool, error) {
+	var result interface{}
+	if err := q.QueryRowxContext(ctx, query).Scan(&result); err != nil {
+		return false, err
+	}
+	switch v := result.(type) {
+	case bool:
+		return v, nil
+	case int64:
+		return v != 0, nil
+	default:
+		return false, fmt.Errorf("unexpected result %v, want boolean or integer", result)
+	}
+}
@@ -0,0 +1,44 @@
+package pgmigrate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckStatementLimit(t *testing.T) {
+	sql := strings.Repeat("INSERT INTO t VALUES (1);\n", 5)
+	tests := []struct {
+		max     int
+		wantErr bool
+	}{
+		{0, false},
+		{5, false},
+		{6, false},
+		{4, true},
+	}
+	for _, tt := range tests {
+		err := checkStatementLimit(sql, tt.max)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkStatementLimit(5 statements, %d) = %v, want error %v", tt.max, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckStatementLimitFile(t *testing.T) {
+	m := DefaultMigrator("")
+	m.MigrationDir = testDir(t, map[string]string{
+		"0001_dump.pgsql": "-- migrate:up\n" + strings.Repeat("INSERT INTO t VALUES (1);\n", 11) + "-- migrate:down\nDELETE FROM t;\n",
+	})
+	files, err := m.migrationFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := m.readMigration(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkStatementLimit(m.upSQL(content), 10)
+	if err == nil || !strings.Contains(err.Error(), "11 statements") {
+		t.Errorf("checkStatementLimit of a file of 11 statements = %v, want an error counting 11", err)
+	}
+}
@@ -0,0 +1,94 @@
+package pgmigrate
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// AuditReport lists the discrepancies between the migrations table and
+// MigrationDir found by Audit, each sorted by id
+type AuditReport struct {
+	Missing    []string           // applied migrations whose file no longer exists
+	Pending    []string           // migrations not applied yet, dirty ones included
+	Mismatches []ChecksumMismatch // applied migrations whose file changed since
+	OutOfOrder []string           // migrations applied after one with a greater id
+	Future     []string           // migrations whose applied_at is later than the database's now()
+}
+
+// Clean reports whether the audit found nothing
+func (r AuditReport) Clean() bool {
+	return len(r.Missing)+len(r.Pending)+len(r.Mismatches)+len(r.OutOfOrder)+len(r.Future) == 0
+}
+
+// Audit cross-references the migrations table with MigrationDir in a single
+// report, e.g. for a daily job. Ids are compared as strings to find the
+// migrations applied out of order, which matches the order runs apply them
+// in unless UseSemanticVersioning is set.
+func (m *Migrator) Audit() (AuditReport, error) {
+	ctx := context.Background()
+	var report AuditReport
+	db, err := m.connect(ctx)
+	if err != nil {
+		return report, err
+	}
+	defer m.close(db)
+	tracked, err := m.tracked(ctx, db)
+	if err != nil {
+		return report, err
+	}
+	files, err := m.migrationFiles()
+	if err != nil {
+		return report, err
+	}
+	var now time.Time
+	if err := db.QueryRowxContext(ctx, "SELECT now()").Scan(&now); err != nil {
+		return report, err
+	}
+
+	onDisk := make(map[string]bool, len(files))
+	for _, file := range files {
+		id := m.migrationID(file)
+		onDisk[id] = true
+		if row, ok := tracked[id]; !ok || row.Status.String == statusDirty {
+			report.Pending = append(report.Pending, id)
+		}
+	}
+	if report.Mismatches, err = m.checksumMismatches(tracked, files); err != nil {
+		return report, err
+	}
+
+	var applied []trackedMigration
+	for id, row := range tracked {
+		if !onDisk[id] {
+			report.Missing = append(report.Missing, id)
+		}
+		if row.AppliedAt.Valid {
+			applied = append(applied, row)
+			if row.AppliedAt.Time.After(now) {
+				report.Future = append(report.Future, id)
+			}
+		}
+	}
+	sort.Slice(applied, func(i, j int) bool {
+		if !applied[i].AppliedAt.Time.Equal(applied[j].AppliedAt.Time) {
+			return applied[i].AppliedAt.Time.Before(applied[j].AppliedAt.Time)
+		}
+		return applied[i].ID < applied[j].ID
+	})
+	greatest := ""
+	for _, row := range applied {
+		if row.ID < greatest {
+			report.OutOfOrder = append(report.OutOfOrder, row.ID)
+		} else {
+			greatest = row.ID
+		}
+	}
+
+	sort.Strings(report.Pending)
+	sort.Strings(report.Missing)
+	sort.Strings(report.OutOfOrder)
+	sort.Strings(report.Future)
+	sort.Slice(report.Mismatches, func(i, j int) bool { return report.Mismatches[i].ID < report.Mismatches[j].ID })
+	return report, nil
+}
@@ -0,0 +1,224 @@
+package pgmigrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AuditLogFormat is the version of the AuditLog format. It changes only
+// when fields are renamed, removed or change meaning.
+const AuditLogFormat = 2
+
+// AuditLog is the record of a run produced by MigrateWithAuditLog. It is
+// serialized as JSON with the field names given in the tags; timestamps are
+// RFC 3339 in UTC.
+//
+// Its entries form a hash chain: the hash of each one is the hex sha256 of
+// the previous hash followed by the entry's fields, see AuditEntry.digest.
+// The chain starts from the hash of the run's own fields, Format to Error,
+// see AuditLog.seed, and Hash is that of the last entry (the seed without
+// entries). Changing the run's fields, or changing, removing or reordering
+// entries breaks the chain, which Verify detects; keep Hash somewhere the
+// log can't be changed along with it, e.g. in the deployment record.
+type AuditLog struct {
+	Format   int          `json:"format"` // AuditLogFormat
+	RunID    string       `json:"run_id"` // as recorded in the migrations table
+	Operator string       `json:"operator"`
+	Started  time.Time    `json:"started"`
+	Finished time.Time    `json:"finished"`
+	Success  bool         `json:"success"`
+	Error    string       `json:"error,omitempty"` // of the run, when it failed
+	Entries  []AuditEntry `json:"entries"`         // in the order the migrations started
+	Hash     string       `json:"hash"`
+}
+
+// AuditEntry records a migration the run executed. Migrations already
+// applied by earlier runs have none.
+type AuditEntry struct {
+	ID         string    `json:"id"`
+	Checksum   string    `json:"checksum"` // of the content executed
+	Started    time.Time `json:"started"`
+	DurationMS int64     `json:"duration_ms"`
+	State      string    `json:"state"`               // a State name, or "failed"
+	SQLState   string    `json:"sql_state,omitempty"` // SQLSTATE of the failure, if from the database
+	Error      string    `json:"error,omitempty"`
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `json:"hash"`
+}
+
+// digest returns the hash of e chained to prev: the hex sha256 of prev and
+// the other fields of e, in their declaration order, each followed by a
+// newline, times formatted as RFC 3339 with nanoseconds
+func (e AuditEntry) digest(prev string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%d\n%s\n%s\n%s\n", prev, e.ID, e.Checksum,
+		e.Started.UTC().Format(time.RFC3339Nano), e.DurationMS, e.State, e.SQLState, e.Error)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// seed returns the hash the entries of l are chained to: the hex sha256 of
+// the fields of l before Entries, in their declaration order, each followed
+// by a newline, times formatted as RFC 3339 with nanoseconds
+func (l *AuditLog) seed() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n%s\n%s\n%s\n%t\n%s\n", l.Format, l.RunID, l.Operator,
+		l.Started.UTC().Format(time.RFC3339Nano), l.Finished.UTC().Format(time.RFC3339Nano), l.Success, l.Error)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify checks the hash chain of l. Logs of another AuditLogFormat, whose
+// chain is built differently, fail.
+func (l *AuditLog) Verify() error {
+	if l.Format != AuditLogFormat {
+		return fmt.Errorf("audit log format %d, want %d", l.Format, AuditLogFormat)
+	}
+	prev := l.seed()
+	for i, e := range l.Entries {
+		if i == 0 && e.PrevHash != prev {
+			return errors.New("audit log run fields were altered")
+		}
+		if e.PrevHash != prev || e.digest(prev) != e.Hash {
+			return fmt.Errorf("audit log entry %d (%s) was altered", i, e.ID)
+		}
+		prev = e.Hash
+	}
+	if l.Hash != prev {
+		return errors.New("audit log hash doesn't match its run and entries")
+	}
+	return nil
+}
+
+// MigrateWithAuditLog executes the migrations like MigrateResults and
+// returns the AuditLog of the run, also when it fails. When path is not
+// empty, the log is written there as indented JSON, replacing the file.
+// The operator is the user running the process; the database user is
+// recorded in the migrations table. Tracer, if set, still gets its spans.
+func (m *Migrator) MigrateWithAuditLog(ctx context.Context, path string) (*AuditLog, error) {
+	runID, err := newRunID()
+	if err != nil {
+		return nil, err
+	}
+	record := &AuditLog{Format: AuditLogFormat, RunID: runID, Operator: operator(), Started: time.Now().UTC()}
+	tracer := &auditTracer{next: m.Tracer, checksums: m.auditChecksums()}
+	local := *m
+	local.runID = runID
+	local.Tracer = tracer
+	_, err = local.MigrateResults(ctx)
+
+	record.Finished = time.Now().UTC()
+	record.Success = err == nil
+	if err != nil {
+		record.Error = err.Error()
+	}
+	record.Entries = tracer.entries
+	sort.SliceStable(record.Entries, func(i, j int) bool { return record.Entries[i].Started.Before(record.Entries[j].Started) })
+	record.Hash = record.seed()
+	for i := range record.Entries {
+		record.Entries[i].PrevHash = record.Hash
+		record.Entries[i].Hash = record.Entries[i].digest(record.Hash)
+		record.Hash = record.Entries[i].Hash
+	}
+	if path != "" {
+		content, jsonErr := json.MarshalIndent(record, "", "  ")
+		if jsonErr == nil {
+			jsonErr = writeFileAtomic(path, string(content)+"\n")
+		}
+		if jsonErr != nil && err == nil {
+			err = fmt.Errorf("write audit log: %w", jsonErr)
+		}
+	}
+	return record, err
+}
+
+// auditChecksums returns the checksums of the migrations by id, as they are
+// recorded. Files that can't be read are left out: the run reports them.
+func (m *Migrator) auditChecksums() map[string]string {
+	sums := make(map[string]string)
+	files, _ := m.migrationFiles()
+	repeatables, _ := m.repeatableFiles()
+	for _, file := range append(files, repeatables...) {
+		if content, err := m.readMigration(file); err == nil {
+			sums[m.migrationID(file)] = checksum(content)
+		}
+	}
+	return sums
+}
+
+// operator returns the name of the user running the process
+func operator() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// auditTracer collects the migration spans of a run into audit entries,
+// passing every span on to next
+type auditTracer struct {
+	next      Tracer
+	checksums map[string]string
+
+	mu      sync.Mutex // parallel groups end spans concurrently
+	entries []AuditEntry
+}
+
+func (t *auditTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	var next Span = noopSpan{}
+	if t.next != nil {
+		ctx, next = t.next.StartSpan(ctx, name)
+	}
+	if name != "pgmigrate.migration" {
+		return ctx, next
+	}
+	return ctx, &auditSpan{tracer: t, next: next, started: time.Now()}
+}
+
+// auditSpan is a migration span recorded by an auditTracer
+type auditSpan struct {
+	tracer  *auditTracer
+	next    Span
+	started time.Time
+	id      string
+	state   string
+}
+
+func (s *auditSpan) SetAttribute(key, value string) {
+	switch key {
+	case "migration.id":
+		s.id = value
+	case "migration.state":
+		s.state = value
+	}
+	s.next.SetAttribute(key, value)
+}
+
+func (s *auditSpan) End(err error) {
+	entry := AuditEntry{
+		ID:         s.id,
+		Checksum:   s.tracer.checksums[s.id],
+		Started:    s.started.UTC(),
+		DurationMS: time.Since(s.started).Milliseconds(),
+		State:      s.state,
+	}
+	if err != nil {
+		entry.State = "failed"
+		entry.Error = err.Error()
+		var merr *MigrationError
+		if errors.As(err, &merr) {
+			entry.SQLState = merr.SQLState
+		}
+	}
+	s.tracer.mu.Lock()
+	s.tracer.entries = append(s.tracer.entries, entry)
+	s.tracer.mu.Unlock()
+	s.next.End(err)
+}
@@ -0,0 +1,39 @@
+package pgmigrate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuditLogVerifyCoversRunFields(t *testing.T) {
+	started := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := &AuditLog{
+		Format:   AuditLogFormat,
+		RunID:    "run",
+		Operator: "deploy",
+		Started:  started,
+		Finished: started.Add(time.Minute),
+		Error:    "migration 0002_items: exec failed",
+		Entries:  []AuditEntry{{ID: "0001_orders", Checksum: "abc", Started: started, State: "applied"}},
+	}
+	l.Hash = l.seed()
+	for i := range l.Entries {
+		l.Entries[i].PrevHash = l.Hash
+		l.Entries[i].Hash = l.Entries[i].digest(l.Hash)
+		l.Hash = l.Entries[i].Hash
+	}
+	if err := l.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	altered := *l
+	altered.Success = true
+	altered.Error = ""
+	if err := altered.Verify(); err == nil {
+		t.Error("Verify accepted a log whose run fields were altered")
+	}
+	altered = *l
+	altered.Entries = nil
+	if err := altered.Verify(); err == nil {
+		t.Error("Verify accepted a log whose entries were removed")
+	}
+}
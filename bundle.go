@@ -0,0 +1,159 @@
+package pgmigrate
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// bundleManifest is the name of the manifest of a migration bundle
+const bundleManifest = "bundle.json"
+
+// BundleManifest describes the migrations of a bundle written by
+// CreateMigrationBundle
+type BundleManifest struct {
+	Migrations []BundleEntry `json:"migrations"` // in the order they run
+	Repeatable []BundleEntry `json:"repeatable"` // in the order they run
+}
+
+// BundleEntry is a migration of a bundle. File is relative to the root of
+// the bundle; Checksum is that of ChecksumFile.
+type BundleEntry struct {
+	ID       string `json:"id"`
+	File     string `json:"file"`
+	Checksum string `json:"checksum"`
+}
+
+// CreateMigrationBundle writes every file of MigrationDir to a zip archive
+// at outputPath, with a bundle.json manifest listing the migrations in the
+// order they run and their checksums. Ship it with a deployment and run it
+// with NewMigratorFromBundle.
+func (m *Migrator) CreateMigrationBundle(outputPath string) error {
+	var manifest BundleManifest
+	files, err := m.migrationFiles()
+	if err != nil {
+		return err
+	}
+	if manifest.Migrations, err = m.bundleEntries(files); err != nil {
+		return err
+	}
+	repeatables, err := m.repeatableFiles()
+	if err != nil {
+		return err
+	}
+	if manifest.Repeatable, err = m.bundleEntries(repeatables); err != nil {
+		return err
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	all, err := getFiles(m.MigrationDir)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(out)
+	for _, file := range all {
+		rel, err := filepath.Rel(m.MigrationDir, file)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		if err := writeZipFile(zw, filepath.ToSlash(rel), content); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := writeZipFile(zw, bundleManifest, manifestJSON); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (m *Migrator) bundleEntries(files []string) ([]BundleEntry, error) {
+	entries := make([]BundleEntry, len(files))
+	for i, file := range files {
+		rel, err := filepath.Rel(m.MigrationDir, file)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := ChecksumFile(file)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = BundleEntry{ID: m.migrationID(file), File: filepath.ToSlash(rel), Checksum: sum}
+	}
+	return entries, nil
+}
+
+func writeZipFile(zw *zip.Writer, name string, content []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// NewMigratorFromBundle extracts the bundle written by CreateMigrationBundle
+// at bundlePath to a temporary directory and returns a DefaultMigrator
+// reading its migrations from there; set Conn before running it. Every
+// migration of the manifest must be in the bundle with its checksum. The
+// directory is left for the caller to remove.
+func NewMigratorFromBundle(bundlePath string) (*Migrator, error) {
+	dir, err := ioutil.TempDir("", "pgmigrate-bundle-")
+	if err != nil {
+		return nil, err
+	}
+	if err := extractArchive(bundlePath, dir); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	manifestPath := filepath.Join(dir, bundleManifest)
+	content, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("%s: %w", bundlePath, err)
+	}
+	var manifest BundleManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("%s: %s: %w", bundlePath, bundleManifest, err)
+	}
+	// the manifest isn't a migration
+	if err := os.Remove(manifestPath); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	m := DefaultMigrator("")
+	m.MigrationDir = dir
+	for _, e := range append(manifest.Migrations, manifest.Repeatable...) {
+		sum, err := ChecksumFile(filepath.Join(dir, filepath.FromSlash(e.File)))
+		if err == nil && sum != e.Checksum {
+			err = fmt.Errorf("checksum %s, bundled as %s", sum, e.Checksum)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("%s: migration %s: %w", bundlePath, e.ID, err)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,29 @@
+package pgmigrate
+
+import (
+	"sync"
+	"time"
+)
+
+// lastSuccess maps Conn + ":" + Table to the time of the last successful run
+var lastSuccess sync.Map
+
+func (m *Migrator) cacheKey() string {
+	return m.Conn + ":" + m.Table
+}
+
+// cached reports whether a run on the same database and table succeeded
+// less than CacheTTL ago
+func (m *Migrator) cached() bool {
+	if m.CacheTTL <= 0 {
+		return false
+	}
+	v, ok := lastSuccess.Load(m.cacheKey())
+	return ok && time.Since(v.(time.Time)) < m.CacheTTL
+}
+
+func (m *Migrator) markSuccess() {
+	if m.CacheTTL > 0 {
+		lastSuccess.Store(m.cacheKey(), time.Now())
+	}
+}
@@ -0,0 +1,91 @@
+package pgmigrate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+)
+
+// checksum returns the hex sha256 of a migration's content. When applying a
+// migration, Migrate hashes the very bytes it executes the up part of, read
+// once for both, so the recorded checksum matches the SQL that was applied
+// even if the file changes on disk during the run.
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Checksum returns the checksum Migrate records for the migration id: see
+// ChecksumFile. With NormalizeLineEndings it is that of the file with CRLF
+// line endings converted to LF.
+func (m *Migrator) Checksum(id string) (string, error) {
+	file, err := m.migrationFile(id)
+	if err != nil {
+		return "", err
+	}
+	content, err := m.readMigration(file)
+	if err != nil {
+		return "", err
+	}
+	return checksum(content), nil
+}
+
+// ChecksumFile returns the checksum Migrate records for the migration file
+// at path without NormalizeLineEndings: the lower-case hex SHA-256 of the
+// whole file, up and down parts and headers included, with its \i includes
+// replaced by the files they name, as executed. Byte order marks and CRLF
+// line endings are part of the hash. For a file without includes
+//
+//	sha256sum <file>
+//
+// reproduces it. Use Migrator.Checksum for the checksum recorded with
+// NormalizeLineEndings.
+func ChecksumFile(path string) (string, error) {
+	content, err := readIncluding(path)
+	if err != nil {
+		return "", err
+	}
+	return checksum(content), nil
+}
+
+// readMigration reads a migration file with its \i includes resolved,
+// normalized as configured
+func (m *Migrator) readMigration(file string) ([]byte, error) {
+	content, err := readIncluding(file)
+	if err != nil || !m.NormalizeLineEndings {
+		return content, err
+	}
+	return normalizeLineEndings(content), nil
+}
+
+// readIncluding reads file with its \i includes resolved
+func readIncluding(file string) ([]byte, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return resolveIncludes(file, content, nil)
+}
+
+// normalizeLineEndings replaces every CRLF of content with LF
+func normalizeLineEndings(content []byte) []byte {
+	return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+}
+
+// checksumMatches reports whether the checksum stored for a migration
+// matches the file at path, and returns the file's checksum. With
+// NormalizeLineEndings the checksum of the file as stored matches too, for
+// migrations applied before it was turned on.
+func (m *Migrator) checksumMatches(stored, path string) (string, bool, error) {
+	content, err := readIncluding(path)
+	if err != nil {
+		return "", false, err
+	}
+	sum := checksum(content)
+	if !m.NormalizeLineEndings || sum == stored {
+		return sum, sum == stored, nil
+	}
+	sum = checksum(normalizeLineEndings(content))
+	return sum, sum == stored, nil
+}
@@ -0,0 +1,64 @@
+package pgmigrate
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeLineEndings(t *testing.T) {
+	got := string(normalizeLineEndings([]byte("SELECT 1;\r\nSELECT '\r';\r\n")))
+	if want := "SELECT 1;\nSELECT '\r';\n"; got != want {
+		t.Errorf("normalizeLineEndings = %q, want %q", got, want)
+	}
+}
+
+func TestChecksumLineEndings(t *testing.T) {
+	m := DefaultMigrator("")
+	m.MigrationDir = testDir(t, map[string]string{
+		"lf.pgsql":   "CREATE TABLE t (id int);\nSELECT 1;\n",
+		"crlf.pgsql": "CREATE TABLE t (id int);\r\nSELECT 1;\r\n",
+	})
+	lf, crlf := filepath.Join(m.MigrationDir, "lf.pgsql"), filepath.Join(m.MigrationDir, "crlf.pgsql")
+	sum := func(file string) string {
+		t.Helper()
+		content, err := m.readMigration(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return checksum(content)
+	}
+
+	if sum(lf) == sum(crlf) {
+		t.Error("CRLF and LF files hash the same without NormalizeLineEndings")
+	}
+	m.NormalizeLineEndings = true
+	if sum(lf) != sum(crlf) {
+		t.Error("CRLF and LF files hash differently with NormalizeLineEndings")
+	}
+
+	// a checksum recorded before NormalizeLineEndings was set still matches
+	raw, err := ChecksumFile(crlf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stored := range []string{raw, sum(lf)} {
+		if _, ok, err := m.checksumMatches(stored, crlf); err != nil || !ok {
+			t.Errorf("checksumMatches(%s) = %v, %v, want a match", stored, ok, err)
+		}
+	}
+}
+
+func TestChecksumFileIncludes(t *testing.T) {
+	dir := testDir(t, map[string]string{
+		"include/common.sql": "SELECT 1;\r\n",
+		"0001_a.pgsql":       "\\i include/common.sql\nSELECT 2;\n",
+	})
+	got, err := ChecksumFile(filepath.Join(dir, "0001_a.pgsql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the include is hashed in place, its CRLF kept
+	if want := checksum([]byte("SELECT 1;\r\n\nSELECT 2;\n")); got != want {
+		t.Errorf("ChecksumFile = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+// Command pgmigrate applies the migrations of a directory to a database:
+//
+//	pgmigrate -conn "$DATABASE_URL" -dir migrations
+//
+// Interrupting it (Ctrl-C or SIGTERM) cancels the run: the migration in
+// flight is rolled back and the advisory lock released before it exits.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/netplugs/pgmigrate"
+)
+
+func main() {
+	var (
+		conn  = flag.String("conn", os.Getenv("DATABASE_URL"), "connection string: default $DATABASE_URL")
+		dir   = flag.String("dir", "migrations", "directory holding the migrations")
+		table = flag.String("table", "migrations", "table tracking applied migrations")
+	)
+	flag.Parse()
+	if *conn == "" {
+		fmt.Fprintln(os.Stderr, "pgmigrate: -conn or $DATABASE_URL is required")
+		os.Exit(2)
+	}
+	m := pgmigrate.DefaultMigrator(*conn)
+	m.MigrationDir = *dir
+	m.Table = *table
+
+	ctx, stop := SignalContext()
+	defer stop()
+	if err := m.MigrateContext(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "pgmigrate:", err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+// SignalContext returns a context cancelled on SIGINT or SIGTERM, and a
+// function to stop listening. Passing it to MigrateContext makes an
+// interrupted run roll back its open transaction and release the advisory
+// lock: the cancelled transaction is rolled back by database/sql, which also
+// drops its connection, ending the session holding the lock, and the run
+// unlocks explicitly on the way out. A second signal, once stop has been
+// called or the context is done, gets the default behavior and kills the
+// process.
+func SignalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-ch:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(ch)
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,73 @@
+package pgmigrate
+
+import (
+	"context"
+	"sort"
+)
+
+// CompareReport is the difference between the migrations applied to two
+// databases, found by CompareTo. Each list is sorted by id.
+type CompareReport struct {
+	Ahead    []string // applied here, not on the other database
+	Behind   []string // applied on the other database, not here
+	Diverged []string // applied on both with different checksums
+	Unknown  []string // applied on the other database, without a file in MigrationDir
+}
+
+// CompareTo compares the migrations table of m with that of other, e.g. the
+// databases of two environments managed by the same code. Skipped and dirty
+// migrations count as applied; migrations recorded without a checksum never
+// diverge.
+func (m *Migrator) CompareTo(other *Migrator) (CompareReport, error) {
+	ctx := context.Background()
+	var report CompareReport
+	rows, err := m.trackedRows(ctx)
+	if err != nil {
+		return report, err
+	}
+	otherRows, err := other.trackedRows(ctx)
+	if err != nil {
+		return report, err
+	}
+	files, err := m.migrationFiles()
+	if err != nil {
+		return report, err
+	}
+	onDisk := make(map[string]bool, len(files))
+	for _, file := range files {
+		onDisk[m.migrationID(file)] = true
+	}
+	for id, row := range rows {
+		otherRow, ok := otherRows[id]
+		if !ok {
+			report.Ahead = append(report.Ahead, id)
+			continue
+		}
+		if row.Checksum.Valid && otherRow.Checksum.Valid && row.Checksum.String != otherRow.Checksum.String {
+			report.Diverged = append(report.Diverged, id)
+		}
+	}
+	for id := range otherRows {
+		if _, ok := rows[id]; !ok {
+			report.Behind = append(report.Behind, id)
+		}
+		if !onDisk[id] {
+			report.Unknown = append(report.Unknown, id)
+		}
+	}
+	sort.Strings(report.Ahead)
+	sort.Strings(report.Behind)
+	sort.Strings(report.Diverged)
+	sort.Strings(report.Unknown)
+	return report, nil
+}
+
+// trackedRows connects and returns the rows of the migrations table by id
+func (m *Migrator) trackedRows(ctx context.Context) (map[string]trackedMigration, error) {
+	db, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close(db)
+	return m.tracked(ctx, db)
+}
@@ -0,0 +1,29 @@
+package pgmigrate
+
+import (
+	"text/template"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// WithConnection calls fn with a copy of m using db as its DB. Changes fn
+// makes to the copy, including to SessionVars and registered templates,
+// don't affect m, so a Migrator shared by goroutines can be scoped to a
+// connection each without races. db is left open.
+func (m *Migrator) WithConnection(db *sqlx.DB, fn func(*Migrator) error) error {
+	scoped := *m
+	scoped.DB = db
+	if m.SessionVars != nil {
+		scoped.SessionVars = make(map[string]string, len(m.SessionVars))
+		for k, v := range m.SessionVars {
+			scoped.SessionVars[k] = v
+		}
+	}
+	if m.templates != nil {
+		scoped.templates = make(map[string]*template.Template, len(m.templates))
+		for k, v := range m.templates {
+			scoped.templates[k] = v
+		}
+	}
+	return fn(&scoped)
+}
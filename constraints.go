@@ -0,0 +1,192 @@
+package pgmigrate
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ConstraintViolation reports the rows of a table that don't satisfy one of
+// its constraints
+type ConstraintViolation struct {
+	Table         string
+	Constraint    string
+	ViolatingRows int
+}
+
+// CheckConstraints verifies that the existing rows of every table in the
+// current schema satisfy its CHECK, NOT NULL and FOREIGN KEY constraints,
+// which matters for constraints added NOT VALID. Constraints without
+// violations are not reported.
+func (m *Migrator) CheckConstraints() ([]ConstraintViolation, error) {
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close(db)
+
+	var checks []struct {
+		Schema     string `db:"schema_name"`
+		Table      string `db:"table_name"`
+		Name       string `db:"constraint_name"`
+		Definition string `db:"definition"`
+	}
+	err = db.SelectContext(ctx, &checks, `
+		SELECT n.nspname AS schema_name, cl.relname AS table_name, c.conname AS constraint_name,
+			pg_get_constraintdef(c.oid) AS definition
+		FROM pg_constraint c
+		JOIN pg_class cl ON cl.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		WHERE n.nspname = current_schema() AND c.contype = 'c'
+		ORDER BY cl.relname, c.conname`)
+	if err != nil {
+		return nil, err
+	}
+	var violations []ConstraintViolation
+	for _, c := range checks {
+		expr := strings.TrimSuffix(strings.TrimPrefix(c.Definition, "CHECK "), " NOT VALID")
+		query := "SELECT count(*) FROM " + qualify(c.Schema, c.Table) + " WHERE NOT (" + expr + ")"
+		n, err := countRows(ctx, db, query)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			violations = append(violations, ConstraintViolation{Table: c.Table, Constraint: c.Name, ViolatingRows: n})
+		}
+	}
+
+	var notNulls []struct {
+		Schema string `db:"schema_name"`
+		Table  string `db:"table_name"`
+		Column string `db:"column_name"`
+	}
+	err = db.SelectContext(ctx, &notNulls, `
+		SELECT n.nspname AS schema_name, cl.relname AS table_name, a.attname AS column_name
+		FROM pg_attribute a
+		JOIN pg_class cl ON cl.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		WHERE n.nspname = current_schema() AND cl.relkind IN ('r', 'p')
+			AND a.attnum > 0 AND NOT a.attisdropped AND a.attnotnull
+		ORDER BY cl.relname, a.attnum`)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range notNulls {
+		query := "SELECT count(*) FROM " + qualify(c.Schema, c.Table) + " WHERE " + pq.QuoteIdentifier(c.Column) + " IS NULL"
+		n, err := countRows(ctx, db, query)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			violations = append(violations, ConstraintViolation{Table: c.Table, Constraint: c.Column + " NOT NULL", ViolatingRows: n})
+		}
+	}
+
+	fkViolations, err := foreignKeyViolations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range fkViolations {
+		violations = append(violations, ConstraintViolation(v))
+	}
+	return violations, nil
+}
+
+// ForeignKeyViolation reports the rows of a table referencing missing rows
+// through one of its foreign keys
+type ForeignKeyViolation struct {
+	Table         string
+	Constraint    string
+	ViolatingRows int
+}
+
+// ValidateForeignKeys verifies that the existing rows of every table in the
+// current schema satisfy its FOREIGN KEY constraints, e.g. as an assertion
+// after migrations adding them NOT VALID. Rows with a NULL in the key are
+// not violations. Constraints without violations are not reported.
+func (m *Migrator) ValidateForeignKeys() ([]ForeignKeyViolation, error) {
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close(db)
+	return foreignKeyViolations(ctx, db)
+}
+
+func foreignKeyViolations(ctx context.Context, db *sqlx.DB) ([]ForeignKeyViolation, error) {
+	fks, err := foreignKeys(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	var violations []ForeignKeyViolation
+	for _, fk := range fks {
+		n, err := countRows(ctx, db, fk.violationQuery())
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			violations = append(violations, ForeignKeyViolation{Table: fk.Table, Constraint: fk.Name, ViolatingRows: n})
+		}
+	}
+	return violations, nil
+}
+
+// foreignKey describes a FOREIGN KEY constraint of the current schema
+type foreignKey struct {
+	Schema     string         `db:"schema_name"`
+	Table      string         `db:"table_name"`
+	Name       string         `db:"constraint_name"`
+	Columns    pq.StringArray `db:"columns"`
+	RefSchema  string         `db:"ref_schema_name"`
+	RefTable   string         `db:"ref_table_name"`
+	RefColumns pq.StringArray `db:"ref_columns"`
+}
+
+func foreignKeys(ctx context.Context, db *sqlx.DB) ([]foreignKey, error) {
+	var fks []foreignKey
+	err := db.SelectContext(ctx, &fks, `
+		SELECT n.nspname AS schema_name, cl.relname AS table_name, c.conname AS constraint_name,
+			ARRAY(SELECT a.attname FROM unnest(c.conkey) WITH ORDINALITY k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+				ORDER BY k.ord)::text[] AS columns,
+			rn.nspname AS ref_schema_name, rcl.relname AS ref_table_name,
+			ARRAY(SELECT a.attname FROM unnest(c.confkey) WITH ORDINALITY k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = c.confrelid AND a.attnum = k.attnum
+				ORDER BY k.ord)::text[] AS ref_columns
+		FROM pg_constraint c
+		JOIN pg_class cl ON cl.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		JOIN pg_class rcl ON rcl.oid = c.confrelid
+		JOIN pg_namespace rn ON rn.oid = rcl.relnamespace
+		WHERE n.nspname = current_schema() AND c.contype = 'f'
+		ORDER BY cl.relname, c.conname`)
+	return fks, err
+}
+
+// violationQuery counts the rows whose non-null key has no match in the
+// referenced table (MATCH SIMPLE semantics)
+func (fk foreignKey) violationQuery() string {
+	var notNull, match []string
+	for i, col := range fk.Columns {
+		notNull = append(notNull, "child."+pq.QuoteIdentifier(col)+" IS NOT NULL")
+		match = append(match, "parent."+pq.QuoteIdentifier(fk.RefColumns[i])+" = child."+pq.QuoteIdentifier(col))
+	}
+	return "SELECT count(*) FROM " + qualify(fk.Schema, fk.Table) + " AS child WHERE " +
+		strings.Join(notNull, " AND ") + " AND NOT EXISTS (SELECT 1 FROM " +
+		qualify(fk.RefSchema, fk.RefTable) + " AS parent WHERE " + strings.Join(match, " AND ") + ")"
+}
+
+func countRows(ctx context.Context, db *sqlx.DB, query string) (int, error) {
+	var n int
+	err := db.QueryRowxContext(ctx, query).Scan(&n)
+	return n, err
+}
+
+// qualify returns the quoted schema-qualified name of a relation
+func qualify(schema, name string) string {
+	return pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(name)
+}
@@ -0,0 +1,102 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DependencyError is returned for a migration whose depends-on header names
+// migrations that are not applied:
+//
+//	-- pgmigrate: depends-on: 0003_create_users.pgsql, 0007_create_orders.pgsql
+//
+// requires is another name of depends-on. Neither changes the order
+// migrations run in, that of their files; they only check it.
+type DependencyError struct {
+	ID      string
+	Missing []string // ids named by depends-on and not applied
+}
+
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("migration %s depends on %s, not applied", e.ID, strings.Join(e.Missing, ", "))
+}
+
+// checkDependsOn returns a *DependencyError if any of deps is not applied.
+// Migrations applied earlier in the same run count as applied, except
+// within a parallel group.
+func (m *Migrator) checkDependsOn(ctx context.Context, db *sqlx.DB, id string, deps []string) error {
+	var missing []string
+	for _, dep := range deps {
+		status, found, err := m.trackedStatus(ctx, db, dep)
+		if err != nil {
+			return err
+		}
+		if !found || status != "applied" {
+			missing = append(missing, dep)
+		}
+	}
+	if len(missing) > 0 {
+		return &DependencyError{ID: id, Missing: missing}
+	}
+	return nil
+}
+
+// Plan returns the ids of the migrations the next run would apply, in the
+// order they would run, without applying them. It fails with a
+// *DependencyError if one of them depends on a migration that is neither
+// applied nor planned before it.
+func (m *Migrator) Plan(ctx context.Context) ([]string, error) {
+	db, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close(db)
+	files, err := m.migrationFiles()
+	if err != nil {
+		return nil, err
+	}
+	tracked, err := m.tracked(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := m.selected(ctx, db, files)
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[string]bool, len(tracked))
+	for id, row := range tracked {
+		if !row.Status.Valid {
+			done[id] = true
+		}
+	}
+	var plan []string
+	for _, file := range files {
+		id := m.migrationID(file)
+		if !selected[id] {
+			continue
+		}
+		content, err := m.readMigration(file)
+		if err != nil {
+			return plan, err
+		}
+		header, err := ParseMigrationHeader(content)
+		if err != nil {
+			return plan, fmt.Errorf("migration %s: %w", id, err)
+		}
+		var missing []string
+		for _, dep := range header.DependsOn {
+			if !done[dep] {
+				missing = append(missing, dep)
+			}
+		}
+		if len(missing) > 0 {
+			return plan, &DependencyError{ID: id, Missing: missing}
+		}
+		done[id] = true
+		plan = append(plan, id)
+	}
+	return plan, nil
+}
@@ -0,0 +1,40 @@
+package pgmigrate
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInsufficientDiskSpace is returned when less disk space than required
+// is available
+type ErrInsufficientDiskSpace struct {
+	Available int64 // bytes available to the process
+	Required  int64 // bytes required
+}
+
+func (e *ErrInsufficientDiskSpace) Error() string {
+	return fmt.Sprintf("insufficient disk space: %d bytes available, %d required", e.Available, e.Required)
+}
+
+// errDiskSpaceUnsupported is returned by freeDiskSpace on platforms without
+// statfs
+var errDiskSpaceUnsupported = errors.New("disk space check not supported on this platform")
+
+// CheckDiskSpace returns an *ErrInsufficientDiskSpace if the file system of
+// MigrationDir has less than minFreeBytes available. It measures the local
+// disk, which is the database's only when Postgres runs on the same host or
+// volume, as in single-container setups. On platforms without statfs the
+// check is skipped.
+func (m *Migrator) CheckDiskSpace(minFreeBytes int64) error {
+	available, err := freeDiskSpace(m.MigrationDir)
+	if err == errDiskSpaceUnsupported {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if available < minFreeBytes {
+		return &ErrInsufficientDiskSpace{Available: available, Required: minFreeBytes}
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!openbsd
+
+package pgmigrate
+
+func freeDiskSpace(path string) (int64, error) {
+	return 0, errDiskSpaceUnsupported
+}
@@ -0,0 +1,164 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Severity ranks a Diagnostic
+type Severity int
+
+// Severities of diagnostics, least severe first
+const (
+	SeverityInfo    Severity = iota // worth knowing, nothing to fix
+	SeverityWarning                 // likely a problem, runs still work
+	SeverityError                   // runs fail or misbehave until fixed
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// Diagnostic is a problem found by Doctor
+type Diagnostic struct {
+	Severity Severity
+	Check    string // name of the check that found it, e.g. "connect"
+	Message  string
+	Hint     string // how to fix it
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", d.Severity, d.Check, d.Message, d.Hint)
+}
+
+// Doctor checks the configuration of m and the state of its database and
+// returns the problems found, most severe first: MigrationDir exists and
+// holds well-named migrations with distinct timestamps, the database is
+// reachable, the migrations table can be written, and every tracked
+// migration has an unchanged file and isn't dirty. Checks needing the
+// database are skipped when it can't be reached. The error is only for
+// failures of Doctor itself.
+func (m *Migrator) Doctor(ctx context.Context) ([]Diagnostic, error) {
+	var diags []Diagnostic
+	report := func(severity Severity, check, hint, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{Severity: severity, Check: check, Message: fmt.Sprintf(format, args...), Hint: hint})
+	}
+	err := m.diagnose(ctx, report)
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Severity > diags[j].Severity })
+	return diags, err
+}
+
+// diagnose runs the checks of Doctor, passing each problem to report
+func (m *Migrator) diagnose(ctx context.Context, report func(severity Severity, check, hint, format string, args ...interface{})) error {
+
+	var files []string
+	if info, err := os.Stat(m.MigrationDir); err != nil || !info.IsDir() {
+		report(SeverityError, "directory", "set MigrationDir to the directory holding the migrations, relative to the working directory",
+			"migration directory %s doesn't exist", m.MigrationDir)
+	} else {
+		var err error
+		if files, err = m.migrationFiles(); err != nil {
+			report(SeverityError, "files", "fix the migration directory or LockFile", "listing migrations: %v", err)
+		}
+	}
+	stems := make(map[string]string)
+	for _, file := range files {
+		id := m.migrationID(file)
+		if ext := filepath.Ext(file); ext != ".pgsql" && ext != ".sql" {
+			report(SeverityWarning, "filename", "rename it to .pgsql or move it out of MigrationDir",
+				"%s doesn't look like a migration but will be applied as one", id)
+		}
+		stem, ok := m.timestampStem(filepath.Base(file))
+		if !ok {
+			report(SeverityInfo, "filename", "create migrations with CreateMigration to get a timestamp",
+				"%s doesn't start with a timestamp; it runs in path order", id)
+			continue
+		}
+		if other, ok := stems[stem]; ok {
+			report(SeverityWarning, "duplicate", "give one of them a later timestamp, e.g. with ReorderMigrations",
+				"%s and %s share the timestamp %s, their order depends on the rest of their names", other, id, stem)
+		}
+		stems[stem] = id
+	}
+
+	db, err := m.connect(ctx)
+	if err == nil {
+		err = db.PingContext(ctx)
+		if err != nil {
+			m.close(db)
+		}
+	}
+	if err != nil {
+		report(SeverityError, "connect", "check Conn: host, port, database, user and password", "can't connect: %v", err)
+		return nil
+	}
+	defer m.close(db)
+
+	var exists, writable bool
+	if err := db.QueryRowxContext(ctx, "SELECT to_regclass($1) IS NOT NULL", m.Table).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		err = db.QueryRowxContext(ctx, "SELECT has_table_privilege($1, 'SELECT, INSERT, UPDATE, DELETE')", m.Table).Scan(&writable)
+	} else {
+		err = db.QueryRowxContext(ctx, "SELECT has_schema_privilege(current_schema(), 'CREATE')").Scan(&writable)
+	}
+	if err != nil {
+		return err
+	}
+	if !writable {
+		hint := "grant CREATE on the schema to the user of Conn"
+		if exists {
+			hint = "grant SELECT, INSERT, UPDATE and DELETE on " + m.Table + " to the user of Conn"
+		}
+		report(SeverityError, "privileges", hint, "the current user can't maintain the migrations table %s", m.Table)
+	}
+	if !exists {
+		report(SeverityInfo, "table", "run Migrate to create it", "the migrations table %s doesn't exist yet", m.Table)
+		return nil
+	}
+
+	tracked, err := m.tracked(ctx, db)
+	if err != nil {
+		return err
+	}
+	onDisk := make(map[string]bool, len(files))
+	for _, file := range files {
+		onDisk[m.migrationID(file)] = true
+	}
+	var ids []string
+	for id := range tracked {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		row := tracked[id]
+		if row.Status.String == statusDirty {
+			report(SeverityError, "dirty", "run Migrate again to resume it, or repair the database and its row by hand",
+				"migration %s was interrupted between its phases", id)
+		}
+		// without files the directory check already reported the cause
+		if !onDisk[id] && len(files) > 0 {
+			report(SeverityWarning, "orphan", "restore its file, or delete its row if it was removed on purpose",
+				"migration %s is tracked but has no file in %s", id, m.MigrationDir)
+		}
+	}
+	mismatches, err := m.checksumMismatches(tracked, files)
+	if err != nil {
+		return err
+	}
+	for _, c := range mismatches {
+		report(SeverityWarning, "checksum", "revert the file; add a new migration for further changes", "%s", c)
+	}
+	return nil
+}
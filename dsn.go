@@ -0,0 +1,159 @@
+package pgmigrate
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// dsn returns the connection string handed to the driver: Conn with the
+// service definition resolved when UseService is set and the search_path
+// pointed at Schema, or binary_parameters set with PoolerSafe
+func (m *Migrator) dsn() (string, error) {
+	useService := m.UseService && strings.HasPrefix(strings.TrimSpace(m.Conn), "service=")
+	if m.PoolerSafe && m.Schema != "" {
+		return "", errors.New("Schema can't be used with PoolerSafe: set the search_path of the role or database instead")
+	}
+	if !useService && m.Schema == "" && !m.PoolerSafe {
+		return m.Conn, nil
+	}
+	params, err := parseDSN(m.Conn)
+	if err != nil {
+		return "", err
+	}
+	if useService {
+		service, err := loadService(params["service"])
+		if err != nil {
+			return "", err
+		}
+		delete(params, "service")
+		// parameters given in Conn take precedence over the service file
+		for k, v := range params {
+			service[k] = v
+		}
+		params = service
+	}
+	if m.PoolerSafe {
+		// no server-side prepared statements
+		params["binary_parameters"] = "yes"
+	}
+	if m.Schema != "" {
+		// sent as a run-time parameter so every connection uses it
+		params["search_path"] = pq.QuoteIdentifier(m.Schema)
+	}
+	return formatDSN(params), nil
+}
+
+// loadService reads the parameters of the named service from $PGSERVICEFILE
+// or ~/.pg_service.conf
+func loadService(name string) (map[string]string, error) {
+	path := os.Getenv("PGSERVICEFILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".pg_service.conf")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		params  map[string]string
+		current string
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[' && line[len(line)-1] == ']':
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			if current == name {
+				params = make(map[string]string)
+			}
+		case current == name:
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("%s: invalid line %q in service %s", path, line, name)
+			}
+			params[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if params == nil {
+		return nil, fmt.Errorf("%s: service %s not found", path, name)
+	}
+	return params, nil
+}
+
+// parseDSN parses a key=value or postgres:// URL connection string
+func parseDSN(conn string) (map[string]string, error) {
+	if strings.HasPrefix(conn, "postgres://") || strings.HasPrefix(conn, "postgresql://") {
+		var err error
+		if conn, err = pq.ParseURL(conn); err != nil {
+			return nil, err
+		}
+	}
+	params := make(map[string]string)
+	s := strings.TrimSpace(conn)
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid connection string: missing value for %q", s)
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		var value strings.Builder
+		if strings.HasPrefix(s, "'") {
+			i := 1
+			for ; i < len(s) && s[i] != '\''; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("invalid connection string: unterminated quote for %s", key)
+			}
+			s = s[i+1:]
+		} else {
+			end := strings.IndexAny(s, " \t\n")
+			if end < 0 {
+				end = len(s)
+			}
+			value.WriteString(s[:end])
+			s = s[end:]
+		}
+		params[key] = value.String()
+		s = strings.TrimSpace(s)
+	}
+	return params, nil
+}
+
+// formatDSN renders params as a key=value connection string with keys in
+// sorted order
+func formatDSN(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		v := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(params[k])
+		parts[i] = k + "='" + v + "'"
+	}
+	return strings.Join(parts, " ")
+}
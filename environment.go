@@ -0,0 +1,75 @@
+package pgmigrate
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// splitVariant splits the environment off a migration file name of the form
+// <name>.<env><ext> (<name>.<env>.up.sql with MarkersGolangMigrate). It
+// returns the path of the base variant, <name><ext>, and the environment, or
+// file and "" when file is a base variant. An environment is the last
+// dot-separated part of the name if it holds only letters, digits and
+// dashes and the rest holds an underscore, so the fractional seconds of
+// timestamp ids ("...T10:00:00.123Z_name.pgsql") are not mistaken for one.
+func (m *Migrator) splitVariant(file string) (string, string) {
+	ext := filepath.Ext(file)
+	if m.MarkerStyle == MarkersGolangMigrate {
+		for _, suffix := range []string{".up.sql", ".down.sql"} {
+			if strings.HasSuffix(file, suffix) {
+				ext = suffix
+			}
+		}
+	}
+	stem := strings.TrimSuffix(file, ext)
+	dot := strings.LastIndexByte(stem, '.')
+	if dot < 0 {
+		return file, ""
+	}
+	name, env := stem[:dot], stem[dot+1:]
+	if env == "" || !strings.Contains(filepath.Base(name), "_") || strings.ContainsRune(env, filepath.Separator) {
+		return file, ""
+	}
+	for _, r := range env {
+		if !(r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return file, ""
+		}
+	}
+	return name + ext, env
+}
+
+// resolveVariants keeps a single variant of each migration among files, in
+// this order of precedence:
+//
+//  1. <name>.<Environment><ext>, the variant of the current environment
+//  2. <name><ext>, the base variant
+//
+// A migration with neither, i.e. only variants of other environments, is
+// left out. The kept file takes the place of the first variant in files.
+// Without Environment, every file left out as a variant is logged: its name
+// may only look like one, e.g. a backup copy or a dotted version.
+func (m *Migrator) resolveVariants(files []string) []string {
+	var (
+		resolved []string
+		index    = make(map[string]int) // base path -> index in resolved
+	)
+	for _, file := range files {
+		base, env := m.splitVariant(file)
+		if env != "" && env != m.Environment {
+			if m.Environment == "" {
+				m.logf("warning: skipping %s, the variant of migration %s for environment %q, as Environment is not set", file, m.migrationID(file), env)
+			}
+			continue
+		}
+		i, ok := index[base]
+		if !ok {
+			index[base] = len(resolved)
+			resolved = append(resolved, file)
+			continue
+		}
+		if env != "" {
+			resolved[i] = file
+		}
+	}
+	return resolved
+}
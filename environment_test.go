@@ -0,0 +1,51 @@
+package pgmigrate
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// variantFiles has a migration with a variant per environment, one with an
+// extra dotted part and a timestamp id with fractional seconds
+var variantFiles = map[string]string{
+	"0001_seed.pgsql":                       "SELECT 1;\n",
+	"0001_seed.staging.pgsql":               "SELECT 2;\n",
+	"0002_users.backup.pgsql":               "SELECT 3;\n",
+	"2020-01-01T10:00:00.123Z_orders.pgsql": "SELECT 4;\n",
+}
+
+func TestResolveVariants(t *testing.T) {
+	tests := []struct {
+		env  string
+		want []string
+		logs int
+	}{
+		{"", []string{"0001_seed.pgsql", "2020-01-01T10:00:00.123Z_orders.pgsql"}, 2},
+		{"staging", []string{"0001_seed.staging.pgsql", "2020-01-01T10:00:00.123Z_orders.pgsql"}, 0},
+	}
+	for _, tt := range tests {
+		var logs bytes.Buffer
+		m := DefaultMigrator("")
+		m.MigrationDir = testDir(t, variantFiles)
+		m.Environment = tt.env
+		m.Logger = log.New(&logs, "", 0)
+		files, err := m.migrationFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, file := range files {
+			got = append(got, filepath.Base(file))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Environment %q: files %q, want %q", tt.env, got, tt.want)
+		}
+		if n := strings.Count(logs.String(), "warning: skipping"); n != tt.logs {
+			t.Errorf("Environment %q: %d files logged as skipped, want %d:\n%s", tt.env, n, tt.logs, logs.String())
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GenerateERD writes an entity-relationship diagram of the tables of the
+// current schema to outputPath in the DOT language of Graphviz: one node per
+// table listing its columns and types, one edge per foreign key pointing to
+// the referenced table. Render it with e.g. dot -Tpng.
+func (m *Migrator) GenerateERD(outputPath string) error {
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.close(db)
+
+	var columns []struct {
+		Table  string `db:"table_name"`
+		Column string `db:"column_name"`
+		Type   string `db:"data_type"`
+	}
+	err = db.SelectContext(ctx, &columns, `
+		SELECT t.table_name, c.column_name, c.data_type
+		FROM information_schema.tables t
+		JOIN information_schema.columns c ON c.table_schema = t.table_schema AND c.table_name = t.table_name
+		WHERE t.table_schema = current_schema() AND t.table_type = 'BASE TABLE'
+		ORDER BY t.table_name, c.ordinal_position`)
+	if err != nil {
+		return err
+	}
+	var keys []struct {
+		Table      string `db:"table_name"`
+		Referenced string `db:"referenced_table"`
+		Name       string `db:"constraint_name"`
+	}
+	err = db.SelectContext(ctx, &keys, `
+		SELECT cl.relname AS table_name, rcl.relname AS referenced_table, c.conname AS constraint_name
+		FROM pg_constraint c
+		JOIN pg_class cl ON cl.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		JOIN pg_class rcl ON rcl.oid = c.confrelid
+		WHERE n.nspname = current_schema() AND c.contype = 'f'
+		ORDER BY cl.relname, c.conname`)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph erd {\n\trankdir=LR;\n\tnode [shape=record];\n")
+	for i := 0; i < len(columns); {
+		table := columns[i].Table
+		label := escapeRecord(table) + "|"
+		for ; i < len(columns) && columns[i].Table == table; i++ {
+			label += escapeRecord(columns[i].Column+" "+columns[i].Type) + `\l`
+		}
+		fmt.Fprintf(&b, "\t%s [label=\"{%s}\"];\n", strconv.Quote(table), label)
+	}
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n", strconv.Quote(k.Table), strconv.Quote(k.Referenced), strconv.Quote(k.Name))
+	}
+	b.WriteString("}\n")
+	return writeFileAtomic(outputPath, b.String())
+}
+
+// escapeRecord escapes the characters with a meaning in a DOT record label
+func escapeRecord(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "{", `\{`, "}", `\}`, "|", `\|`, "<", `\<`, ">", `\>`).Replace(s)
+}
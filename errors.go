@@ -0,0 +1,91 @@
+package pgmigrate
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Stages of a run reported in MigrationError
+const (
+	StageConnect     = "connect"
+	StageLock        = "lock"
+	StageCreateTable = "createtable"
+	StageRead        = "read"
+	StageVerify      = "verify"
+	StageExec        = "exec"
+	StageTrack       = "track"
+)
+
+// MigrationError is returned when a run fails. Use errors.As to inspect it,
+// e.g. to tell a unique violation (SQLState 23505) from a syntax error
+// (42601).
+type MigrationError struct {
+	ID       string // migration being applied, empty before the first one
+	SQLState string // SQLSTATE code of a database error, if any
+	Stage    string // one of the Stage constants
+	Err      error
+}
+
+func (e *MigrationError) Error() string {
+	msg := e.Stage + ": " + e.Err.Error()
+	if e.ID != "" {
+		msg = "migration " + e.ID + ": " + msg
+	}
+	if e.SQLState != "" {
+		msg += " (SQLSTATE " + e.SQLState + ")"
+	}
+	return msg
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// migrationError wraps err, if any, in a MigrationError
+func migrationError(stage, id string, err error) error {
+	if err == nil {
+		return nil
+	}
+	e := &MigrationError{ID: id, Stage: stage, Err: err}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		e.SQLState = string(pqErr.Code)
+	}
+	return e
+}
+
+// ErrorPolicy decides what a run does when a migration fails
+type ErrorPolicy int
+
+const (
+	// StopOnError ends the run at the first migration that fails, the
+	// default
+	StopOnError ErrorPolicy = iota
+	// ContinueOnError logs a migration that fails and goes on with the next
+	// migrations; the run then returns a *RunError. The failed migration is
+	// not recorded, unless TrackBefore or its phases recorded it already, so
+	// the next run retries it. Migrations depending on it are expected to
+	// fail too.
+	ContinueOnError
+)
+
+// RunError lists the migrations that failed in a run under ContinueOnError,
+// in the order they ran
+type RunError struct {
+	Errors []error
+}
+
+func (e *RunError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the first failure, so errors.As finds its MigrationError
+func (e *RunError) Unwrap() error {
+	return e.Errors[0]
+}
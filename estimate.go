@@ -0,0 +1,47 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// EstimateDuration estimates how long applying the migrations returned by
+// Plan takes, from the durations recorded when they were applied to the
+// databases of HistoryConns. When several recorded one, the slowest counts,
+// to size maintenance windows safely. Pending migrations without a recorded
+// duration anywhere are returned as unknown and not counted.
+func (m *Migrator) EstimateDuration(ctx context.Context) (estimate time.Duration, unknown []string, err error) {
+	pending, err := m.Plan(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	slowest := make(map[string]time.Duration)
+	for i, conn := range m.HistoryConns {
+		other := *m
+		other.Conn = conn
+		other.DB = nil
+		history, err := other.History(time.Time{})
+		if err != nil {
+			return 0, nil, fmt.Errorf("history database %d: %w", i+1, err)
+		}
+		for _, e := range history {
+			// rows recorded before durations were tracked have no run id
+			if e.RunID == "" {
+				continue
+			}
+			if d, ok := slowest[e.ID]; !ok || e.Duration > d {
+				slowest[e.ID] = e.Duration
+			}
+		}
+	}
+	for _, id := range pending {
+		d, ok := slowest[id]
+		if !ok {
+			unknown = append(unknown, id)
+			continue
+		}
+		estimate += d
+	}
+	return estimate, unknown, nil
+}
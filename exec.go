@@ -0,0 +1,198 @@
+package pgmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// copyFrom matches COPY ... FROM statements and captures their source:
+// STDIN, PROGRAM or a quoted server-side file name
+var copyFrom = regexp.MustCompile(`(?is)^COPY\s.*?\sFROM\s+(STDIN|PROGRAM|')`)
+
+// copySource returns "STDIN", "PROGRAM" or "'" for COPY ... FROM
+// statements, or "" for other statements
+func copySource(stmt string) string {
+	match := copyFrom.FindStringSubmatch(stripComments(stmt))
+	if match == nil {
+		return ""
+	}
+	if match[1] == "'" {
+		return match[1]
+	}
+	return strings.ToUpper(match[1])
+}
+
+// copyOptions matches COPY options changing the data format from the
+// default tab-separated text, which copyIn can't parse
+var copyOptions = regexp.MustCompile(`(?i)\b(CSV|BINARY|DELIMITER)\b`)
+
+// execSQL executes the SQL of a migration on e and returns the rows it
+// affected. With split each statement is sent on its own and the rows
+// affected are summed; otherwise the server reports those of the last
+// statement only. COPY ... FROM PROGRAM and COPY ... FROM 'file' read their
+// data on the server and are passed through verbatim. COPY ... FROM STDIN
+// followed by inline data, as written by pg_dump, is streamed with the COPY
+// protocol, which forces split mode and requires a transaction; it counts
+// its data rows.
+func (m *Migrator) execSQL(ctx context.Context, e sqlx.ExecerContext, sql string, split bool) (int64, error) {
+	stmts := splitScript(sql)
+	if !split && !hasCopyData(stmts) {
+		res, err := e.ExecContext(ctx, sql)
+		if err != nil {
+			return 0, err
+		}
+		return rowsAffected(res), nil
+	}
+	var rows int64
+	for _, stmt := range stmts {
+		if stmt.HasData {
+			if err := copyIn(ctx, e, stmt); err != nil {
+				return rows, err
+			}
+			rows += int64(len(stmt.Rows))
+			continue
+		}
+		if copySource(stmt.SQL) == "STDIN" {
+			return rows, fmt.Errorf(`COPY ... FROM STDIN needs inline data ending with a \. line: %.40s`, stmt.SQL)
+		}
+		res, err := e.ExecContext(ctx, stmt.SQL)
+		if err != nil {
+			return rows, err
+		}
+		rows += rowsAffected(res)
+	}
+	return rows, nil
+}
+
+// rowsAffected returns the rows affected of res, 0 for statements that
+// report none
+func rowsAffected(res sql.Result) int64 {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func hasCopyData(stmts []statement) bool {
+	for _, stmt := range stmts {
+		if stmt.HasData {
+			return true
+		}
+	}
+	return false
+}
+
+// copyIn streams the inline rows of a COPY ... FROM STDIN statement. Rows
+// are in the text format: tab-separated, \N for NULL, backslash escapes.
+func copyIn(ctx context.Context, e sqlx.ExecerContext, stmt statement) error {
+	// pq switches to the COPY protocol for prepared statements starting
+	// with COPY: the comments pg_dump writes before them must go
+	query := stripComments(stmt.SQL)
+	if copyOptions.MatchString(query) {
+		return fmt.Errorf("COPY ... FROM STDIN supports only the default text format: %.40s", query)
+	}
+	p, ok := e.(interface {
+		PrepareContext(context.Context, string) (*sql.Stmt, error)
+	})
+	if !ok {
+		return fmt.Errorf("COPY ... FROM STDIN is not supported here: %.40s", query)
+	}
+	copyStmt, err := p.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer copyStmt.Close()
+	for _, row := range stmt.Rows {
+		if _, err := copyStmt.ExecContext(ctx, copyFields(row)...); err != nil {
+			return err
+		}
+	}
+	_, err = copyStmt.ExecContext(ctx)
+	return err
+}
+
+// copyFields decodes a row of COPY text format into its field values
+func copyFields(row string) []interface{} {
+	parts := strings.Split(row, "\t")
+	fields := make([]interface{}, len(parts))
+	for i, part := range parts {
+		if part == `\N` {
+			continue
+		}
+		fields[i] = unescapeCopy(part)
+	}
+	return fields
+}
+
+// unescapeCopy resolves the backslash escapes of a COPY text field
+func unescapeCopy(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case 'x':
+			n, end := 0, i+1
+			for ; end < len(s) && end < i+3 && isHexDigit(s[end]); end++ {
+				n = n*16 + hexValue(s[end])
+			}
+			if end == i+1 {
+				b.WriteByte('x')
+				continue
+			}
+			b.WriteByte(byte(n))
+			i = end - 1
+		default:
+			if c >= '0' && c <= '7' {
+				n, end := 0, i
+				for ; end < len(s) && end < i+3 && s[end] >= '0' && s[end] <= '7'; end++ {
+					n = n*8 + int(s[end]-'0')
+				}
+				b.WriteByte(byte(n))
+				i = end - 1
+				continue
+			}
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func hexValue(c byte) int {
+	switch {
+	case c >= 'a':
+		return int(c-'a') + 10
+	case c >= 'A':
+		return int(c-'A') + 10
+	default:
+		return int(c - '0')
+	}
+}
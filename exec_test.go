@@ -0,0 +1,50 @@
+package pgmigrate
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dumpCopy is a COPY block as pg_dump writes it, after a comment
+const dumpCopy = "--\n-- Data for Name: items; Type: TABLE DATA\n--\n\nCOPY items (id, name) FROM stdin;\n1\tapple\n2\t\\N\n\\.\n"
+
+func TestSplitScriptCommentedCopy(t *testing.T) {
+	stmts := splitScript("CREATE TABLE items (id int, name text);\n\n" + dumpCopy)
+	if len(stmts) != 2 {
+		t.Fatalf("got %d statements, want 2: %+v", len(stmts), stmts)
+	}
+	stmt := stmts[1]
+	if !stmt.HasData {
+		t.Fatalf("COPY after comments has no data: %q", stmt.SQL)
+	}
+	if want := []string{"1\tapple", "2\t\\N"}; !reflect.DeepEqual(stmt.Rows, want) {
+		t.Errorf("rows %q, want %q", stmt.Rows, want)
+	}
+	if query := stripComments(stmt.SQL); !strings.HasPrefix(query, "COPY items") {
+		t.Errorf("copyIn would prepare %q, which doesn't start with COPY", query)
+	}
+}
+
+func TestCopyFields(t *testing.T) {
+	got := copyFields("1\t\\N\ta\\tb")
+	want := []interface{}{"1", nil, "a\tb"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("copyFields = %q, want %q", got, want)
+	}
+}
+
+func TestMigrateCommentedCopy(t *testing.T) {
+	m := testMigrator(t, map[string]string{
+		"0001_items.pgsql": "CREATE TABLE items (id int, name text);\n\n" + dumpCopy,
+	})
+	if _, err := m.MigrateResults(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	testQuery(t, m, &n, "SELECT count(*) FROM items")
+	if n != 2 {
+		t.Errorf("%d rows copied, want 2", n)
+	}
+}
@@ -0,0 +1,63 @@
+package pgmigrate
+
+import (
+	"context"
+	"strings"
+)
+
+// ExplainMigration returns the EXPLAIN (FORMAT TEXT, VERBOSE) output of each
+// statement of migration id without applying it. Everything runs in a
+// transaction that is rolled back. Statements EXPLAIN doesn't support, such
+// as DDL, are skipped.
+func (m *Migrator) ExplainMigration(id string) (string, error) {
+	ctx := context.Background()
+	file, err := m.migrationFile(id)
+	if err != nil {
+		return "", err
+	}
+	content, err := m.readMigration(file)
+	if err != nil {
+		return "", err
+	}
+	db, err := m.connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer m.close(db)
+	txn, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer txn.Rollback()
+
+	var out strings.Builder
+	for _, stmt := range splitStatements(m.upSQL(content)) {
+		if !explainable(stmt) {
+			continue
+		}
+		var plan []string
+		if err := txn.SelectContext(ctx, &plan, "EXPLAIN (FORMAT TEXT, VERBOSE) "+stmt); err != nil {
+			return "", err
+		}
+		out.WriteString("-- " + stripComments(stmt) + "\n")
+		out.WriteString(strings.Join(plan, "\n") + "\n\n")
+	}
+	return out.String(), nil
+}
+
+// explainable reports whether EXPLAIN accepts stmt
+func explainable(stmt string) bool {
+	words := keywords(stmt, 3)
+	if len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "VALUES", "WITH", "EXECUTE", "DECLARE", "MERGE", "TABLE":
+		return true
+	case "CREATE":
+		// CREATE TABLE ... AS and CREATE MATERIALIZED VIEW ... AS
+		upper := strings.ToUpper(stripComments(stmt))
+		return len(words) > 1 && (words[1] == "TABLE" || words[1] == "MATERIALIZED") && strings.Contains(upper, " AS ")
+	}
+	return false
+}
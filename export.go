@@ -0,0 +1,211 @@
+package pgmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// trackingColumnNames returns the columns of the migrations table, id first
+func trackingColumnNames() []string {
+	names := []string{"id"}
+	for _, column := range trackingColumns {
+		names = append(names, strings.Fields(column)[0])
+	}
+	return names
+}
+
+// ExportTracking writes the rows of the migrations table to w as INSERT
+// statements, one per line in id order, for ImportTracking to load into
+// the migrations table of another database. Values are exported as text
+// literals, NULLs kept, so the round trip is lossless.
+func (m *Migrator) ExportTracking(ctx context.Context, w io.Writer) error {
+	db, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.close(db)
+	if err := createMigrationsTableIfNotExists(db, m.Table); err != nil {
+		return err
+	}
+	columns := trackingColumnNames()
+	selects := make([]string, len(columns))
+	for i, c := range columns {
+		selects[i] = c + "::text"
+	}
+	rows, err := db.QueryContext(ctx, "SELECT "+strings.Join(selects, ", ")+" FROM "+m.Table+" ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		literals := make([]string, len(values))
+		for i, v := range values {
+			literals[i] = "NULL"
+			if v.Valid {
+				literals[i] = pq.QuoteLiteral(v.String)
+			}
+		}
+		_, err := fmt.Fprintf(w, "%s (%s) VALUES (%s) ON CONFLICT (id) DO NOTHING;\n",
+			m.insertInto(), strings.Join(columns, ", "), strings.Join(literals, ", "))
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ImportTracking loads the INSERT statements written by ExportTracking
+// into the migrations table, created if needed, in a single transaction.
+// Rows whose id is already tracked are kept as they are. The statements are
+// not executed as they are: each must insert quoted literals or NULL into
+// columns of Table, exactly as ExportTracking writes them, and its values
+// are inserted as parameters. Anything else is refused before connecting.
+func (m *Migrator) ImportTracking(ctx context.Context, r io.Reader) error {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var rows []trackingInsert
+	for _, stmt := range splitStatements(string(content)) {
+		row, err := m.parseTrackingInsert(stmt)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+	db, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.close(db)
+	if err := createMigrationsTableIfNotExists(db, m.Table); err != nil {
+		return err
+	}
+	txn, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		params := make([]string, len(row.Values))
+		args := make([]interface{}, len(row.Values))
+		for i, v := range row.Values {
+			params[i] = fmt.Sprintf("$%d", i+1)
+			args[i] = v
+		}
+		query := fmt.Sprintf("%s (%s) VALUES (%s) ON CONFLICT (id) DO NOTHING",
+			m.insertInto(), strings.Join(row.Columns, ", "), strings.Join(params, ", "))
+		if _, err := txn.ExecContext(ctx, query, args...); err != nil {
+			txn.Rollback()
+			return err
+		}
+	}
+	return txn.Commit()
+}
+
+// trackingInsert is a row of the migrations table read by ImportTracking
+type trackingInsert struct {
+	Columns []string
+	Values  []sql.NullString
+}
+
+// parseTrackingInsert parses a statement written by ExportTracking. The
+// columns must be tracking columns, id first, and the values quoted
+// literals or NULL.
+func (m *Migrator) parseTrackingInsert(stmt string) (trackingInsert, error) {
+	refused := fmt.Errorf("not an insert into %s written by ExportTracking: %.40s", m.Table, stmt)
+	const suffix = ") ON CONFLICT (id) DO NOTHING"
+	rest := strings.TrimSuffix(stmt, ";")
+	if !strings.HasPrefix(rest, m.insertInto()+" (") || !strings.HasSuffix(rest, suffix) {
+		return trackingInsert{}, refused
+	}
+	rest = strings.TrimSuffix(strings.TrimPrefix(rest, m.insertInto()+" ("), suffix)
+	end := strings.Index(rest, ") VALUES (")
+	if end < 0 {
+		return trackingInsert{}, refused
+	}
+	var row trackingInsert
+	known := make(map[string]bool)
+	for _, c := range trackingColumnNames() {
+		known[c] = true
+	}
+	for i, c := range strings.Split(rest[:end], ", ") {
+		if !known[c] || (i == 0) != (c == "id") {
+			return trackingInsert{}, refused
+		}
+		known[c] = false // each column once
+		row.Columns = append(row.Columns, c)
+	}
+	values := rest[end+len(") VALUES ("):]
+	for i := 0; i < len(row.Columns); i++ {
+		if i > 0 {
+			if !strings.HasPrefix(values, ", ") {
+				return trackingInsert{}, refused
+			}
+			values = values[2:]
+		}
+		if strings.HasPrefix(values, "NULL") {
+			row.Values = append(row.Values, sql.NullString{})
+			values = values[len("NULL"):]
+			continue
+		}
+		literal, n, ok := parseQuotedLiteral(values)
+		if !ok {
+			return trackingInsert{}, refused
+		}
+		row.Values = append(row.Values, sql.NullString{String: literal, Valid: true})
+		values = values[n:]
+	}
+	if values != "" {
+		return trackingInsert{}, refused
+	}
+	return row, nil
+}
+
+// parseQuotedLiteral parses the string literal at the start of s as quoted
+// by pq.QuoteLiteral, returning its value and length
+func parseQuotedLiteral(s string) (string, int, bool) {
+	start, escaped := 1, false
+	switch {
+	case strings.HasPrefix(s, " E'"):
+		start, escaped = 3, true
+	case !strings.HasPrefix(s, "'"):
+		return "", 0, false
+	}
+	var b strings.Builder
+	for i := start; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			b.WriteByte(c)
+			i++
+		case c == '\'':
+			return b.String(), i + 1, true
+		case escaped && c == '\\':
+			if i+1 >= len(s) || s[i+1] != '\\' {
+				return "", 0, false
+			}
+			b.WriteByte(c)
+			i++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, false
+}
+
+func (m *Migrator) insertInto() string {
+	return "INSERT INTO " + m.Table
+}
@@ -0,0 +1,41 @@
+package pgmigrate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestParseTrackingInsert(t *testing.T) {
+	m := DefaultMigrator("")
+	script := m.insertInto() + " (id, checksum, status) VALUES (" + pq.QuoteLiteral("0001_it's") + ", " +
+		pq.QuoteLiteral(`a\b`) + ", NULL) ON CONFLICT (id) DO NOTHING;\n"
+	stmts := splitStatements(script)
+	if len(stmts) != 1 {
+		t.Fatalf("%d statements, want 1", len(stmts))
+	}
+	row, err := m.parseTrackingInsert(stmts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"id", "checksum", "status"}; !reflect.DeepEqual(row.Columns, want) {
+		t.Errorf("columns %q, want %q", row.Columns, want)
+	}
+	if row.Values[0].String != "0001_it's" || row.Values[1].String != `a\b` || row.Values[2].Valid {
+		t.Errorf("values %+v", row.Values)
+	}
+
+	for _, stmt := range []string{
+		m.insertInto() + " (id) VALUES ((SELECT some_function())) ON CONFLICT (id) DO NOTHING",
+		m.insertInto() + " (id) VALUES ('a'), ('b') ON CONFLICT (id) DO NOTHING",
+		m.insertInto() + " (id) VALUES ('a' || current_user) ON CONFLICT (id) DO NOTHING",
+		m.insertInto() + " (id, owner) VALUES ('a', 'b') ON CONFLICT (id) DO NOTHING",
+		m.insertInto() + " (checksum, id) VALUES ('a', 'b') ON CONFLICT (id) DO NOTHING",
+		m.insertInto() + " (id) VALUES ('a') ON CONFLICT (id) DO UPDATE SET id = 'b'",
+	} {
+		if _, err := m.parseTrackingInsert(stmt); err == nil {
+			t.Errorf("accepted %q", stmt)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package pgmigrate
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// upToDate reports whether a run on db has nothing to do, in which case it
+// returns the results the run would, without taking the lock. Every
+// migration of MigrationDir must be tracked and not dirty, and there must be
+// no repeatable migration. In any doubt, including errors, it returns false
+// so the run takes the lock and checks again.
+//
+// It stays correct with concurrent runs as tracking rows are only inserted
+// once their migration committed, except with TrackBefore, under which it
+// is never used.
+func (m *Migrator) upToDate(ctx context.Context, db *sqlx.DB) ([]Result, bool) {
+	if m.TrackingOrder == TrackBefore || m.ChecksumPolicy != ChecksumIgnore {
+		return nil, false
+	}
+	repeatables, err := m.repeatableFiles()
+	if err != nil || len(repeatables) > 0 {
+		return nil, false
+	}
+	files, err := m.migrationFiles()
+	if err != nil {
+		return nil, false
+	}
+	ids := make([]string, len(files))
+	for i, file := range files {
+		ids[i] = m.migrationID(file)
+	}
+	var exists bool
+	if err := db.QueryRowxContext(ctx, "SELECT to_regclass($1) IS NOT NULL", m.Table).Scan(&exists); err != nil || !exists {
+		return nil, false
+	}
+	var rows []struct {
+		ID     string `db:"id"`
+		Status string `db:"status"`
+	}
+	err = db.SelectContext(ctx, &rows, "SELECT id, coalesce(status, 'applied') AS status FROM "+m.Table+" WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil || len(rows) != len(ids) {
+		return nil, false
+	}
+	states := make(map[string]State, len(rows))
+	for _, row := range rows {
+		switch row.Status {
+		case statusDirty:
+			return nil, false
+		case statusSkipped:
+			states[row.ID] = StateSkipped
+		default:
+			states[row.ID] = StateAlreadyApplied
+		}
+	}
+	results := make([]Result, len(ids))
+	for i, id := range ids {
+		results[i] = Result{ID: id, State: states[id]}
+	}
+	return results, true
+}
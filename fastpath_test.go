@@ -0,0 +1,61 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// manyMigrations returns n migrations creating a table each
+func manyMigrations(n int) map[string]string {
+	files := make(map[string]string, n)
+	for i := 1; i <= n; i++ {
+		files[fmt.Sprintf("%04d_t%d.pgsql", i, i)] = fmt.Sprintf("CREATE TABLE t%d (id int);\n", i)
+	}
+	return files
+}
+
+func TestUpToDate(t *testing.T) {
+	m := testMigrator(t, manyMigrations(3))
+	ctx := context.Background()
+	if _, err := m.MigrateResults(ctx); err != nil {
+		t.Fatal(err)
+	}
+	db, err := m.connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.close(db)
+	if results, ok := m.upToDate(ctx, db); !ok || len(results) != 3 {
+		t.Errorf("upToDate after migrating = %v, %v, want 3 results", results, ok)
+	}
+	if err := ioutil.WriteFile(filepath.Join(m.MigrationDir, "0004_t4.pgsql"), []byte("CREATE TABLE t4 (id int);\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.upToDate(ctx, db); ok {
+		t.Error("upToDate with a pending migration")
+	}
+}
+
+// BenchmarkFastPath compares runs with nothing to do over 200 applied
+// migrations with and without FastPath
+func BenchmarkFastPath(b *testing.B) {
+	m := testMigrator(b, manyMigrations(200))
+	ctx := context.Background()
+	if _, err := m.MigrateResults(ctx); err != nil {
+		b.Fatal(err)
+	}
+	for _, fastPath := range []bool{false, true} {
+		b.Run(fmt.Sprintf("FastPath=%v", fastPath), func(b *testing.B) {
+			local := *m
+			local.FastPath = fastPath
+			for i := 0; i < b.N; i++ {
+				if _, err := local.MigrateResults(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
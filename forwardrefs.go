@@ -0,0 +1,107 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// createdObject matches the name of a table, view, sequence, type or
+// function created by a statement
+var createdObject = regexp.MustCompile(`(?i)\bCREATE\s+(?:OR\s+REPLACE\s+)?(?:UNLOGGED\s+|TEMP(?:ORARY)?\s+)?` +
+	`(?:TABLE|VIEW|MATERIALIZED\s+VIEW|SEQUENCE|TYPE|FUNCTION|PROCEDURE)\s+(?:IF\s+NOT\s+EXISTS\s+)?([\w."]+)`)
+
+// referencedObject matches the names a statement likely refers to
+var referencedObject = regexp.MustCompile(`(?i)\b(?:REFERENCES|FROM|JOIN|INTO|UPDATE|ON|ALTER\s+TABLE(?:\s+IF\s+EXISTS)?(?:\s+ONLY)?)\s+([\w."]+)`)
+
+// ForwardReference is a pending migration that seems to use an object only
+// created by a pending migration running after it
+type ForwardReference struct {
+	ID        string
+	Object    string
+	CreatedBy string
+}
+
+func (r ForwardReference) String() string {
+	return fmt.Sprintf("migration %s references %s, created by the later migration %s", r.ID, r.Object, r.CreatedBy)
+}
+
+// ForwardReferenceError fails a run under CheckForwardReferences
+type ForwardReferenceError struct {
+	References []ForwardReference
+}
+
+func (e *ForwardReferenceError) Error() string {
+	msgs := make([]string, len(e.References))
+	for i, r := range e.References {
+		msgs[i] = r.String()
+	}
+	return "likely ordering mistakes: " + strings.Join(msgs, "; ")
+}
+
+// ForwardReferences scans the migrations returned by Plan for names used
+// before the pending migration creating them, e.g. a foreign key to a table
+// created later in the batch. It is a best-effort textual heuristic, not a
+// SQL parser: names are compared without their schema, and references in
+// strings or comments, or to objects dropped and recreated, can be reported
+// wrongly, while dynamic SQL is not seen at all.
+func (m *Migrator) ForwardReferences(ctx context.Context) ([]ForwardReference, error) {
+	ids, err := m.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, len(ids))
+	for i, id := range ids {
+		if files[i], err = m.migrationFile(id); err != nil {
+			return nil, err
+		}
+	}
+	return m.forwardReferences(files)
+}
+
+// forwardReferences returns the forward references among files, in the
+// order they run
+func (m *Migrator) forwardReferences(files []string) ([]ForwardReference, error) {
+	created := make([]map[string]bool, len(files))
+	firstCreated := make(map[string]int)
+	sqls := make([]string, len(files))
+	for i, file := range files {
+		content, err := m.readMigration(file)
+		if err != nil {
+			return nil, err
+		}
+		sqls[i] = m.upSQL(content)
+		created[i] = make(map[string]bool)
+		for _, match := range createdObject.FindAllStringSubmatch(sqls[i], -1) {
+			name := objectName(match[1])
+			created[i][name] = true
+			if _, ok := firstCreated[name]; !ok {
+				firstCreated[name] = i
+			}
+		}
+	}
+	var refs []ForwardReference
+	for i, file := range files {
+		seen := make(map[string]bool)
+		for _, match := range referencedObject.FindAllStringSubmatch(sqls[i], -1) {
+			name := objectName(match[1])
+			j, ok := firstCreated[name]
+			if !ok || j <= i || created[i][name] || seen[name] {
+				continue
+			}
+			seen[name] = true
+			refs = append(refs, ForwardReference{ID: m.migrationID(file), Object: name, CreatedBy: m.migrationID(files[j])})
+		}
+	}
+	return refs, nil
+}
+
+// objectName returns the unqualified, unquoted, lower-case name of an
+// object as written in SQL
+func objectName(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.ToLower(strings.Trim(name, `"`))
+}
@@ -0,0 +1,118 @@
+package pgmigrate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dependencies returns the ids of the migrations in the order runs apply
+// them, that of migrationFiles, and the ids named by the depends-on header
+// of each:
+//
+//	-- pgmigrate: depends-on: 2020-01-01T00:00:00Z_create_orders.pgsql
+func (m *Migrator) dependencies() ([]string, map[string][]string, error) {
+	files, err := m.migrationFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	order := make([]string, len(files))
+	deps := make(map[string][]string, len(files))
+	for i, file := range files {
+		order[i] = m.migrationID(file)
+		content, err := m.readMigration(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		header, err := ParseMigrationHeader(content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("migration %s: %w", order[i], err)
+		}
+		deps[order[i]] = header.DependsOn
+	}
+	return order, deps, nil
+}
+
+// dependencyProblem returns why the dependency dep of the migration at
+// position i of order can't be met by a run: "unknown" when it is not a
+// migration of order, "runs later" when it comes after, "" otherwise
+func dependencyProblem(order []string, i int, dep string) string {
+	for j, id := range order {
+		if id != dep {
+			continue
+		}
+		if j > i {
+			return "runs later"
+		}
+		return ""
+	}
+	return "unknown"
+}
+
+// Graph renders the migrations in the order runs apply them, one per line,
+// each with the migrations its depends-on header names. Dependencies a run
+// can't meet, as they come later or are unknown, are flagged:
+//
+//  1. 0001_create_orders.pgsql
+//  2. 0002_create_items.pgsql <- 0001_create_orders.pgsql
+//  3. 0003_add_index.pgsql <- 0004_create_users.pgsql (runs later)
+//
+// It reads the migration files only, not the database.
+func (m *Migrator) Graph() (string, error) {
+	order, deps, err := m.dependencies()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i, id := range order {
+		fmt.Fprintf(&b, "%d. %s", i+1, id)
+		for j, dep := range deps[id] {
+			if j == 0 {
+				b.WriteString(" <- ")
+			} else {
+				b.WriteString(", ")
+			}
+			b.WriteString(dep)
+			if problem := dependencyProblem(order, i, dep); problem != "" {
+				b.WriteString(" (" + problem + ")")
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// GraphDOT renders the migrations and their depends-on headers in the DOT
+// language of Graphviz, e.g. for dot -Tsvg. Edges point from a dependency
+// to the migration depending on it; those a run can't meet are red, and
+// unknown dependencies are dashed nodes.
+func (m *Migrator) GraphDOT() (string, error) {
+	order, deps, err := m.dependencies()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("digraph migrations {\n\trankdir=LR;\n")
+	for _, id := range order {
+		fmt.Fprintf(&b, "\t%s;\n", strconv.Quote(id))
+	}
+	unknown := make(map[string]bool)
+	for i, id := range order {
+		for _, dep := range deps[id] {
+			attrs := ""
+			switch dependencyProblem(order, i, dep) {
+			case "unknown":
+				if !unknown[dep] {
+					unknown[dep] = true
+					fmt.Fprintf(&b, "\t%s [style=dashed];\n", strconv.Quote(dep))
+				}
+				attrs = " [color=red]"
+			case "runs later":
+				attrs = " [color=red]"
+			}
+			fmt.Fprintf(&b, "\t%s -> %s%s;\n", strconv.Quote(dep), strconv.Quote(id), attrs)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
@@ -0,0 +1,51 @@
+package pgmigrate
+
+import (
+	"strings"
+	"testing"
+)
+
+// graphFiles has a dependency met, one on a later migration and one on an
+// unknown migration
+var graphFiles = map[string]string{
+	"0001_orders.pgsql": "CREATE TABLE orders (id int);\n",
+	"0002_items.pgsql":  "-- pgmigrate: depends-on: 0001_orders.pgsql\nCREATE TABLE items (id int);\n",
+	"0003_index.pgsql":  "-- pgmigrate: requires: 0004_users.pgsql, 0009_gone.pgsql\nCREATE INDEX ON items (id);\n",
+	"0004_users.pgsql":  "CREATE TABLE users (id int);\n",
+}
+
+func TestGraph(t *testing.T) {
+	m := DefaultMigrator("")
+	m.MigrationDir = testDir(t, graphFiles)
+	got, err := m.Graph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `1. 0001_orders.pgsql
+2. 0002_items.pgsql <- 0001_orders.pgsql
+3. 0003_index.pgsql <- 0004_users.pgsql (runs later), 0009_gone.pgsql (unknown)
+4. 0004_users.pgsql
+`
+	if got != want {
+		t.Errorf("Graph:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGraphDOT(t *testing.T) {
+	m := DefaultMigrator("")
+	m.MigrationDir = testDir(t, graphFiles)
+	got, err := m.GraphDOT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`"0001_orders.pgsql" -> "0002_items.pgsql";`,
+		`"0004_users.pgsql" -> "0003_index.pgsql" [color=red];`,
+		`"0009_gone.pgsql" [style=dashed];`,
+		`"0009_gone.pgsql" -> "0003_index.pgsql" [color=red];`,
+	} {
+		if !strings.Contains(got, "\t"+line+"\n") {
+			t.Errorf("GraphDOT lacks %s:\n%s", line, got)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package pgmigrate
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// headerPrefix marks a pgmigrate directive in the leading comment block of a
+// migration file, e.g.
+//
+//	-- pgmigrate: precondition: SELECT count(*) < 1000000 FROM orders
+const headerPrefix = "pgmigrate:"
+
+// parseHeaders extracts the pgmigrate directives from the comment lines at
+// the top of a migration. Parsing stops at the first line that is neither
+// blank nor a comment. Keys are lower-cased; repeated keys are joined with
+// a comma.
+func parseHeaders(content []byte) map[string]string {
+	headers := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "--"))
+		if !strings.HasPrefix(line, headerPrefix) {
+			continue
+		}
+		key, value := splitDirective(strings.TrimPrefix(line, headerPrefix))
+		if key == "" {
+			continue
+		}
+		if prev, ok := headers[key]; ok && prev != "" {
+			value = prev + "," + value
+		}
+		headers[key] = value
+	}
+	return headers
+}
+
+// splitDirective splits "key: value" (or "key value") into its parts
+func splitDirective(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return r == ':' || r == ' ' || r == '\t'
+	})
+	if end < 0 {
+		return strings.ToLower(s), ""
+	}
+	key := strings.ToLower(s[:end])
+	value := strings.TrimSpace(s[end:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, ":"))
+	return key, value
+}
+
+// MigrationHeader holds the pgmigrate directives of a migration file:
+//
+//	-- pgmigrate: description: add the orders table
+//	-- pgmigrate: tags: billing, orders
+//	-- pgmigrate: role: app_owner
+//	-- pgmigrate: isolation: serializable
+//	-- pgmigrate: lock-timeout: 5s
+//	-- pgmigrate:if current_setting('app.feature_x', true) = 'on'
+//	-- pgmigrate: depends-on: 0003_create_users.pgsql
+//
+// requires is accepted as another name of depends-on. A migration whose
+// precondition or if condition doesn't hold is skipped without being
+// recorded, so it is evaluated again by every run until it holds.
+type MigrationHeader struct {
+	Description   string
+	Tags          []string
+	Role          string             // role the migration runs as (SET ROLE)
+	Isolation     sql.IsolationLevel // isolation level of its transaction
+	LockTimeout   time.Duration      // lock_timeout while it runs, 0 for the session's
+	NoTransaction bool               // run statement by statement outside a transaction
+	Precondition  string             // query deciding whether it is applied now
+	Condition     string             // boolean SQL expression of the if directive
+	Group         string
+	ParallelGroup string
+	Analyze       []string          // tables analyzed after it committed
+	DependsOn     []string          // ids of migrations that must be applied already
+	Extra         map[string]string // directives not listed above
+}
+
+// ParseMigrationHeader parses the directives in the leading comment block of
+// a migration, without a Migrator or a database. Values of the recognized
+// keys are validated: isolation must be read committed, repeatable read or
+// serializable, and lock-timeout a duration such as 5s or a number of
+// milliseconds as in Postgres.
+func ParseMigrationHeader(content []byte) (MigrationHeader, error) {
+	h := MigrationHeader{Extra: make(map[string]string)}
+	headers := parseHeaders(content)
+	if requires, ok := headers["requires"]; ok {
+		headers["depends-on"] = strings.Trim(headers["depends-on"]+","+requires, ",")
+		delete(headers, "requires")
+	}
+	for key, value := range headers {
+		switch key {
+		case "description":
+			h.Description = value
+		case "tags":
+			h.Tags = splitList(value)
+		case "role":
+			h.Role = value
+		case "isolation":
+			switch strings.Join(strings.Fields(strings.ToLower(value)), " ") {
+			case "read committed":
+				h.Isolation = sql.LevelReadCommitted
+			case "repeatable read":
+				h.Isolation = sql.LevelRepeatableRead
+			case "serializable":
+				h.Isolation = sql.LevelSerializable
+			default:
+				return h, fmt.Errorf("header isolation: unsupported level %q", value)
+			}
+		case "lock-timeout":
+			d, err := parseTimeout(value)
+			if err != nil {
+				return h, fmt.Errorf("header lock-timeout: %w", err)
+			}
+			h.LockTimeout = d
+		case "no-transaction":
+			h.NoTransaction = !strings.EqualFold(value, "false")
+		case "precondition":
+			h.Precondition = value
+		case "if":
+			h.Condition = value
+		case "group":
+			h.Group = value
+		case "parallel-group":
+			h.ParallelGroup = value
+		case "analyze":
+			h.Analyze = splitList(value)
+		case "depends-on":
+			h.DependsOn = splitList(value)
+		default:
+			h.Extra[key] = value
+		}
+	}
+	return h, nil
+}
+
+// parseTimeout parses a Go duration or a number of milliseconds
+func parseTimeout(s string) (time.Duration, error) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// splitList splits a comma-separated header value, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,30 @@
+package pgmigrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMigrationHeaderRequires(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"-- pgmigrate: depends-on: a.pgsql, b.pgsql\nSELECT 1;", []string{"a.pgsql", "b.pgsql"}},
+		{"-- pgmigrate: requires: a.pgsql\nSELECT 1;", []string{"a.pgsql"}},
+		{"-- pgmigrate: depends-on: a.pgsql\n-- pgmigrate: requires: b.pgsql\nSELECT 1;", []string{"a.pgsql", "b.pgsql"}},
+		{"SELECT 1;", nil},
+	}
+	for _, tt := range tests {
+		header, err := ParseMigrationHeader([]byte(tt.content))
+		if err != nil {
+			t.Fatalf("%q: %v", tt.content, err)
+		}
+		if !reflect.DeepEqual(header.DependsOn, tt.want) {
+			t.Errorf("%q: DependsOn %q, want %q", tt.content, header.DependsOn, tt.want)
+		}
+		if _, ok := header.Extra["requires"]; ok {
+			t.Errorf("%q: requires left in Extra", tt.content)
+		}
+	}
+}
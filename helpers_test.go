@@ -0,0 +1,79 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// testConnEnv names the environment variable holding the connection string
+// of the database the tests needing Postgres run against. Without it they
+// are skipped.
+const testConnEnv = "PGMIGRATE_TEST_CONN"
+
+// testDir writes files, their content by name, to a temporary directory
+// removed at the end of the test
+func testDir(tb testing.TB, files map[string]string) string {
+	tb.Helper()
+	dir, err := ioutil.TempDir("", "pgmigrate")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { os.RemoveAll(dir) })
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// testMigrator returns a Migrator of the migrations in files working in a
+// schema of its own of the test database, dropped at the end of the test
+func testMigrator(tb testing.TB, files map[string]string) *Migrator {
+	tb.Helper()
+	conn := os.Getenv(testConnEnv)
+	if conn == "" {
+		tb.Skipf("%s not set", testConnEnv)
+	}
+	db, err := sqlx.Connect("postgres", conn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	schema := fmt.Sprintf("pgmigrate_test_%d", time.Now().UnixNano())
+	if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+		db.Close()
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		db.Close()
+	})
+	m := DefaultMigrator(conn)
+	m.Schema = schema
+	m.MigrationDir = testDir(tb, files)
+	return m
+}
+
+// testQuery scans the single value returned by query on a connection of m
+func testQuery(tb testing.TB, m *Migrator, dest interface{}, query string, args ...interface{}) {
+	tb.Helper()
+	db, err := m.connect(context.Background())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer m.close(db)
+	if err := db.QueryRowx(query, args...).Scan(dest); err != nil {
+		tb.Fatalf("%s: %v", query, err)
+	}
+}
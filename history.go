@@ -0,0 +1,159 @@
+package pgmigrate
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// HistoryEntry describes when, how fast and by whom a migration was applied.
+// Migrations applied before these details were tracked have zero values.
+type HistoryEntry struct {
+	ID        string
+	AppliedAt time.Time
+	Duration  time.Duration
+	AppliedBy string
+	RunID     string
+	ReleaseID string // Migrator.ReleaseID of the run
+}
+
+// History returns the migrations applied at or after since in the order
+// they were applied. A zero since returns the whole history.
+func (m *Migrator) History(since time.Time) ([]HistoryEntry, error) {
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close(db)
+
+	query := "SELECT id, applied_at, duration_ms, applied_by, run_id, release_id FROM " + m.Table
+	var args []interface{}
+	if !since.IsZero() {
+		query += " WHERE applied_at >= $1"
+		args = append(args, since)
+	}
+	query += " ORDER BY applied_at ASC NULLS FIRST, id"
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []HistoryEntry
+	for rows.Next() {
+		var (
+			e          HistoryEntry
+			appliedAt  sql.NullTime
+			durationMS sql.NullInt64
+			appliedBy  sql.NullString
+			runID      sql.NullString
+			releaseID  sql.NullString
+		)
+		if err := rows.Scan(&e.ID, &appliedAt, &durationMS, &appliedBy, &runID, &releaseID); err != nil {
+			return nil, err
+		}
+		e.AppliedAt = appliedAt.Time
+		e.Duration = time.Duration(durationMS.Int64) * time.Millisecond
+		e.AppliedBy = appliedBy.String
+		e.RunID = runID.String
+		e.ReleaseID = releaseID.String
+		history = append(history, e)
+	}
+	return history, rows.Err()
+}
+
+// newRunID returns a random identifier for a Migrate call
+func newRunID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ErrColumnMissing is returned when the migrations table predates the
+// applied_at column
+var ErrColumnMissing = errors.New("pgmigrate: the migrations table has no applied_at column; run Migrate once to upgrade it")
+
+// MigrationStatus describes a migration recorded in the migrations table
+type MigrationStatus struct {
+	ID        string
+	State     State // StateAlreadyApplied, or StateSkipped after Skip
+	AppliedAt time.Time
+	AppliedBy string
+	ReleaseID string
+}
+
+// ListApplied returns the migrations recorded between since and until
+// inclusive in ascending applied_at order. A zero since or until leaves that
+// end unbounded. Migrations recorded before applied_at was tracked are not
+// listed.
+func (m *Migrator) ListApplied(since, until time.Time) ([]MigrationStatus, error) {
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close(db)
+
+	var hasColumn sql.NullBool
+	err = db.QueryRowxContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM pg_attribute
+			WHERE attrelid = c.oid AND attname = 'applied_at' AND NOT attisdropped)
+		FROM (SELECT to_regclass($1) AS oid) c
+		WHERE c.oid IS NOT NULL`, m.Table).Scan(&hasColumn)
+	if err == sql.ErrNoRows {
+		// no migrations table: nothing applied
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !hasColumn.Bool {
+		return nil, ErrColumnMissing
+	}
+
+	query := "SELECT id, coalesce(status, 'applied'), applied_at, applied_by, release_id FROM " + m.Table +
+		" WHERE applied_at IS NOT NULL"
+	var args []interface{}
+	if !since.IsZero() {
+		args = append(args, since)
+		query += fmt.Sprintf(" AND applied_at >= $%d", len(args))
+	}
+	if !until.IsZero() {
+		args = append(args, until)
+		query += fmt.Sprintf(" AND applied_at <= $%d", len(args))
+	}
+	query += " ORDER BY applied_at, id"
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []MigrationStatus
+	for rows.Next() {
+		var (
+			s         MigrationStatus
+			status    string
+			appliedBy sql.NullString
+			releaseID sql.NullString
+		)
+		if err := rows.Scan(&s.ID, &status, &s.AppliedAt, &appliedBy, &releaseID); err != nil {
+			return nil, err
+		}
+		s.State = StateAlreadyApplied
+		if status == statusSkipped {
+			s.State = StateSkipped
+		}
+		s.AppliedBy = appliedBy.String
+		s.ReleaseID = releaseID.String
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,94 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+)
+
+// Impact describes what editing a migration would affect, see ImpactOf
+type Impact struct {
+	ID              string
+	Applied         bool     // tracked in the migrations table, skipped or dirty included
+	StoredChecksum  string   // recorded when it was applied, empty if not applied or recorded without one
+	CurrentChecksum string   // of its file, ChecksumMissing without file
+	Mismatch        bool     // the file already differs from StoredChecksum, or is gone
+	DependedOnBy    []string // migrations naming it in their depends-on (or requires) header
+}
+
+// ImpactOf reports the blast radius of editing the migration id, without
+// changing anything: whether the connected database applied it, in which
+// case an edit makes its checksum mismatch, its recorded and current
+// checksums, and the migrations whose depends-on headers name it. Check
+// other environments with a Migrator connected to each.
+func (m *Migrator) ImpactOf(ctx context.Context, id string) (*Impact, error) {
+	files, err := m.migrationFiles()
+	if err != nil {
+		return nil, err
+	}
+	impact := &Impact{ID: id, CurrentChecksum: ChecksumMissing}
+	var file string
+	for _, f := range files {
+		fid := m.migrationID(f)
+		if fid == id {
+			file = f
+			continue
+		}
+		content, err := m.readMigration(f)
+		if err != nil {
+			return nil, err
+		}
+		header, err := ParseMigrationHeader(content)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", fid, err)
+		}
+		if contains(header.DependsOn, id) {
+			impact.DependedOnBy = append(impact.DependedOnBy, fid)
+		}
+	}
+
+	db, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close(db)
+	tracked, err := m.tracked(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	row, applied := tracked[id]
+	if file == "" && !applied {
+		return nil, fmt.Errorf("migration %s is neither in %s nor applied", id, m.MigrationDir)
+	}
+	impact.Applied = applied
+	if row.Checksum.Valid {
+		impact.StoredChecksum = row.Checksum.String
+	}
+	if file != "" {
+		if impact.StoredChecksum != "" {
+			sum, ok, err := m.checksumMatches(impact.StoredChecksum, file)
+			if err != nil {
+				return nil, err
+			}
+			impact.CurrentChecksum, impact.Mismatch = sum, !ok
+		} else {
+			content, err := m.readMigration(file)
+			if err != nil {
+				return nil, err
+			}
+			impact.CurrentChecksum = checksum(content)
+		}
+	} else if impact.StoredChecksum != "" {
+		impact.Mismatch = true
+	}
+	return impact, nil
+}
+
+// contains reports whether ids holds id
+func contains(ids []string, id string) bool {
+	for _, s := range ids {
+		if s == id {
+			return true
+		}
+	}
+	return false
+}
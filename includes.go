@@ -0,0 +1,65 @@
+package pgmigrate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// includeDir is the subdirectory of MigrationDir holding files included by
+// migrations with \i; they are not migrations themselves
+const includeDir = "include"
+
+// includeDirective matches the psql include meta-commands \i, \ir, \include
+// and \include_relative on a line of their own. The path may be quoted.
+var includeDirective = regexp.MustCompile(`(?m)^[ \t]*\\(?:i|ir|include|include_relative)[ \t]+(.+?)[ \t]*$`)
+
+// isInclude reports whether file is in the include subdirectory
+func (m *Migrator) isInclude(file string) bool {
+	rel := strings.TrimPrefix(m.migrationID(file), m.MigrationIDPrefix+"/")
+	return strings.HasPrefix(rel, includeDir+"/")
+}
+
+// resolveIncludes replaces the \i directives of content, read from file,
+// with the content of the file they name, recursively, as psql would. Paths
+// are relative to the directory of the file holding the directive. Keep the
+// included files outside MigrationDir or in its include subdirectory, or
+// they run as migrations too. chain holds the files being included, to
+// report cycles.
+func resolveIncludes(file string, content []byte, chain []string) ([]byte, error) {
+	file = filepath.Clean(file)
+	chain = append(chain, file)
+	var err error
+	resolved := includeDirective.ReplaceAllFunc(content, func(directive []byte) []byte {
+		if err != nil {
+			return nil
+		}
+		name := string(includeDirective.FindSubmatch(directive)[1])
+		if unquoted := strings.Trim(name, "'"); len(unquoted) == len(name)-2 {
+			name = strings.Replace(unquoted, "''", "'", -1)
+		}
+		path := filepath.Clean(name)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(file), path)
+		}
+		for i, f := range chain {
+			if f == path {
+				err = fmt.Errorf("include cycle: %s", strings.Join(append(chain[i:], path), " -> "))
+				return nil
+			}
+		}
+		var included []byte
+		if included, err = ioutil.ReadFile(path); err != nil {
+			err = fmt.Errorf("%s: include: %w", file, err)
+			return nil
+		}
+		included, err = resolveIncludes(path, included, chain)
+		return included
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
@@ -0,0 +1,25 @@
+package pgmigrate
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIncludesResolvedWhenInspecting(t *testing.T) {
+	m := DefaultMigrator("")
+	m.MigrationDir = testDir(t, map[string]string{
+		"include/path.sql":   "SET search_path TO billing;\n",
+		"0001_orders.pgsql":  "\\i include/path.sql\nCREATE TABLE orders (id int);\n",
+		"0002_missing.pgsql": "\\i include/gone.sql\n",
+	})
+	stmt, err := m.searchPathStatement(filepath.Join(m.MigrationDir, "0001_orders.pgsql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "SET search_path TO billing"; stmt != want {
+		t.Errorf("searchPathStatement = %q, want %q", stmt, want)
+	}
+	if _, err := m.parallelGroup(filepath.Join(m.MigrationDir, "0002_missing.pgsql")); err == nil {
+		t.Error("parallelGroup read a migration with a missing include")
+	}
+}
@@ -0,0 +1,49 @@
+package pgmigrate
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CreateMigrationInteractive asks for the name, description and tags of a
+// new migration on stdin, with defaults in brackets, and creates it with
+// CreateMigrationWithContent. The description and tags are written as
+// pgmigrate headers. When stdin is not a terminal the three values are read
+// as lines without prompting.
+func (m *Migrator) CreateMigrationInteractive() error {
+	interactive := false
+	if info, err := os.Stdin.Stat(); err == nil {
+		interactive = info.Mode()&os.ModeCharDevice != 0
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	ask := func(prompt, def string) string {
+		if interactive {
+			fmt.Printf("%s [%s]: ", prompt, def)
+		}
+		if !scanner.Scan() {
+			return def
+		}
+		if answer := strings.TrimSpace(scanner.Text()); answer != "" {
+			return answer
+		}
+		return def
+	}
+	name := ask("name", "migration")
+	description := ask("description", "")
+	tags := ask("tags (comma separated)", "")
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	var content strings.Builder
+	if description != "" {
+		content.WriteString("-- pgmigrate: description: " + description + "\n")
+	}
+	if tags != "" {
+		content.WriteString("-- pgmigrate: tags: " + tags + "\n")
+	}
+	content.WriteString(m.migrationStub())
+	return m.CreateMigrationWithContent(name, content.String())
+}
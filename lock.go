@@ -0,0 +1,142 @@
+package pgmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrLockContended is returned when another run holds the migration lock
+// and LockRetries are exhausted
+var ErrLockContended = errors.New("pgmigrate: migration lock is held by another run")
+
+// AdvisoryLockKey returns the key of the advisory lock serializing runs:
+// LockKey when set, otherwise a hash of Schema and Table, so runs against
+// different schemas of a database proceed in parallel while runs against
+// the same schema wait for each other
+func (m *Migrator) AdvisoryLockKey() int64 {
+	if m.LockKey != 0 {
+		return m.LockKey
+	}
+	h := fnv.New64a()
+	h.Write([]byte(m.Schema + "." + m.Table))
+	return int64(h.Sum64())
+}
+
+// acquireLock takes the session-level advisory lock of the run, or the
+// lock row with PoolerSafe, retrying LockRetries times LockRetryBackoff
+// apart while another run holds it
+func (m *Migrator) acquireLock(ctx context.Context, db *sqlx.DB) error {
+	backoff := m.LockRetryBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for attempt := 0; ; attempt++ {
+		var locked bool
+		var err error
+		if m.PoolerSafe {
+			locked, err = m.tryLockRow(ctx, db)
+		} else {
+			err = db.QueryRowxContext(ctx, "SELECT pg_try_advisory_lock($1)", m.AdvisoryLockKey()).Scan(&locked)
+		}
+		if err != nil {
+			return err
+		}
+		if locked {
+			return nil
+		}
+		if attempt >= m.LockRetries {
+			return ErrLockContended
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// releaseLock releases the advisory lock, or the lock row with PoolerSafe.
+// It doesn't use the run's context so the lock is released even when the
+// run was cancelled.
+func (m *Migrator) releaseLock(db *sqlx.DB) error {
+	if m.PoolerSafe {
+		_, err := db.Exec("UPDATE "+m.lockTable()+" SET holder = '', expires_at = '-infinity' WHERE id = 1 AND holder = $1", m.lockHolder())
+		return err
+	}
+	_, err := db.Exec("SELECT pg_advisory_unlock($1)", m.AdvisoryLockKey())
+	return err
+}
+
+// lockLease is how long the lock row of a PoolerSafe run is held without
+// being renewed: a run that dies keeps others out that long
+const lockLease = 10 * time.Minute
+
+// lockTable is the table holding the lock row of PoolerSafe runs
+func (m *Migrator) lockTable() string {
+	return m.Table + "_lock"
+}
+
+// lockHolder identifies the process and Migrator holding the lock row
+func (m *Migrator) lockHolder() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d:%p", host, os.Getpid(), m)
+}
+
+// tryLockRow takes the lock row, in a transaction of its own as session
+// state doesn't survive a transaction-pooling proxy: it succeeds when the row
+// is free, expired or already held by m
+func (m *Migrator) tryLockRow(ctx context.Context, db *sqlx.DB) (bool, error) {
+	_, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+m.lockTable()+
+		" (id int PRIMARY KEY, holder text NOT NULL, expires_at timestamptz NOT NULL)")
+	if err != nil {
+		return false, err
+	}
+	txn, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer txn.Rollback()
+	_, err = txn.ExecContext(ctx, "INSERT INTO "+m.lockTable()+" (id, holder, expires_at) VALUES (1, '', '-infinity') ON CONFLICT (id) DO NOTHING")
+	if err != nil {
+		return false, err
+	}
+	var free bool
+	err = txn.QueryRowxContext(ctx, "SELECT holder = '' OR holder = $1 OR expires_at < now() FROM "+m.lockTable()+" WHERE id = 1 FOR UPDATE",
+		m.lockHolder()).Scan(&free)
+	if err != nil || !free {
+		return false, err
+	}
+	_, err = txn.ExecContext(ctx, "UPDATE "+m.lockTable()+" SET holder = $1, expires_at = now() + $2 * interval '1 second' WHERE id = 1",
+		m.lockHolder(), lockLease.Seconds())
+	if err != nil {
+		return false, err
+	}
+	return true, txn.Commit()
+}
+
+// renewLock extends the lease of the lock row of a PoolerSafe run, failing
+// when another run took it over after it expired
+func (m *Migrator) renewLock(ctx context.Context, db *sqlx.DB) error {
+	if !m.PoolerSafe {
+		return nil
+	}
+	res, err := db.ExecContext(ctx, "UPDATE "+m.lockTable()+" SET expires_at = now() + $2 * interval '1 second' WHERE id = 1 AND holder = $1",
+		m.lockHolder(), lockLease.Seconds())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("the migration lock expired and was taken by another run")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package pgmigrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAdvisoryLockKey(t *testing.T) {
+	key := func(schema, table string, lockKey int64) int64 {
+		m := DefaultMigrator("")
+		m.Schema, m.Table, m.LockKey = schema, table, lockKey
+		return m.AdvisoryLockKey()
+	}
+	if key("tenant_a", "migrations", 0) != key("tenant_a", "migrations", 0) {
+		t.Error("same schema and table give different keys")
+	}
+	seen := make(map[int64]string)
+	for _, c := range [][2]string{{"", "migrations"}, {"tenant_a", "migrations"}, {"tenant_b", "migrations"}, {"tenant_a", "schema_versions"}} {
+		k := key(c[0], c[1], 0)
+		if prev, ok := seen[k]; ok {
+			t.Errorf("%s.%s has the key of %s", c[0], c[1], prev)
+		}
+		seen[k] = c[0] + "." + c[1]
+	}
+	if k := key("tenant_a", "migrations", 42); k != 42 {
+		t.Errorf("key with LockKey 42 = %d", k)
+	}
+}
+
+func TestAcquireLockPerSchema(t *testing.T) {
+	a, b := testMigrator(t, nil), testMigrator(t, nil)
+	ctx := context.Background()
+	lock := func(m *Migrator) error {
+		db, err := m.connect(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			m.releaseLock(db)
+			m.close(db)
+		})
+		return m.acquireLock(ctx, db)
+	}
+	if err := lock(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock(b); err != nil {
+		t.Errorf("run on another schema blocked: %v", err)
+	}
+	if err := lock(a); !errors.Is(err, ErrLockContended) {
+		t.Errorf("second run on the same schema: %v, want ErrLockContended", err)
+	}
+}
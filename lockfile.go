@@ -0,0 +1,75 @@
+package pgmigrate
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// lockedFiles orders files as listed in LockFile and drops those it doesn't
+// list. Blank lines and lines starting with # are ignored. An id listed
+// without a file is an error.
+func (m *Migrator) lockedFiles(files []string) ([]string, error) {
+	f, err := os.Open(m.LockFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	byID := make(map[string]string, len(files))
+	for _, file := range files {
+		byID[m.migrationID(file)] = file
+	}
+	var (
+		locked []string
+		seen   = make(map[string]bool)
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id == "" || strings.HasPrefix(id, "#") {
+			continue
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("%s: migration %s listed twice", m.LockFile, id)
+		}
+		seen[id] = true
+		file, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%s: migration %s not found in %s", m.LockFile, id, m.MigrationDir)
+		}
+		locked = append(locked, file)
+	}
+	return locked, scanner.Err()
+}
+
+// UpdateLockFile rewrites LockFile with the ids of the migrations currently
+// in MigrationDir, in the order they sort. Commit it with the migrations,
+// like go.sum: a merge of migrations added concurrently on different
+// branches then shows up as a conflict in it to settle their order.
+func (m *Migrator) UpdateLockFile() error {
+	if m.LockFile == "" {
+		return fmt.Errorf("LockFile is not set")
+	}
+	files, err := m.directoryFiles()
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, file := range files {
+		b.WriteString(m.migrationID(file) + "\n")
+	}
+	return writeFileAtomic(m.LockFile, b.String())
+}
+
+// writeFileAtomic replaces path with content through a temporary file, so
+// readers never see it half written
+func writeFileAtomic(path, content string) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(content), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,13 @@
+package pgmigrate
+
+import "log"
+
+// logf writes a diagnostic message to Logger, or the standard logger when
+// unset
+func (m *Migrator) logf(format string, args ...interface{}) {
+	if m.Logger != nil {
+		m.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,107 @@
+package pgmigrate
+
+import (
+	"bytes"
+	"os"
+	"strings"
+)
+
+// MarkerStyle selects how the up and down parts of a migration are marked,
+// so migration sets written for other tools can be adopted unchanged
+type MarkerStyle int
+
+// Supported marker styles
+const (
+	// MarkersPgmigrate marks sections with "-- migrate:up" and
+	// "-- migrate:down" lines, the same convention dbmate uses. The up marker
+	// is optional: everything before "-- migrate:down" is the up part.
+	MarkersPgmigrate MarkerStyle = iota
+	// MarkersGoose marks sections with "-- +goose Up" and "-- +goose Down".
+	// Other goose annotations are comments and are ignored.
+	MarkersGoose
+	// MarkersGolangMigrate keeps the two parts in separate files, as
+	// golang-migrate does: <id>.up.sql holds the migration and the sibling
+	// <id>.down.sql its rollback. Down files are not migrations themselves.
+	MarkersGolangMigrate
+)
+
+// markers returns the up and down marker lines in effect. UpMarker and
+// DownMarker override the ones of MarkerStyle.
+func (m *Migrator) markers() (string, string) {
+	up, down := "-- migrate:up", "-- migrate:down"
+	if m.MarkerStyle == MarkersGoose {
+		up, down = "-- +goose Up", "-- +goose Down"
+	}
+	if m.UpMarker != "" {
+		up = m.UpMarker
+	}
+	if m.DownMarker != "" {
+		down = m.DownMarker
+	}
+	return up, down
+}
+
+// upSQL returns the part of a migration applied by Migrate
+func (m *Migrator) upSQL(content []byte) string {
+	if m.MarkerStyle == MarkersGolangMigrate {
+		return string(content)
+	}
+	_, down := m.markers()
+	if i := markerOffset(content, down); i >= 0 {
+		return string(content[:i])
+	}
+	return string(content)
+}
+
+// downSQL returns the rollback of the migration in file with content, or ""
+// if it has none
+func (m *Migrator) downSQL(file string, content []byte) (string, error) {
+	if m.MarkerStyle == MarkersGolangMigrate {
+		b, err := m.readMigration(strings.TrimSuffix(file, ".up.sql") + ".down.sql")
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return string(b), err
+	}
+	_, down := m.markers()
+	i := markerOffset(content, down)
+	if i < 0 {
+		return "", nil
+	}
+	return string(content[i:]), nil
+}
+
+// markerOffset returns the offset of the first line of content consisting
+// of marker, or -1
+func markerOffset(content []byte, marker string) int {
+	for offset := 0; offset < len(content); {
+		line := content[offset:]
+		end := bytes.IndexByte(line, '\n')
+		if end >= 0 {
+			line = line[:end]
+		}
+		if strings.TrimSpace(string(line)) == marker {
+			return offset
+		}
+		if end < 0 {
+			break
+		}
+		offset += end + 1
+	}
+	return -1
+}
+
+// isDownFile reports whether file is the rollback half of a golang-migrate
+// style migration
+func (m *Migrator) isDownFile(file string) bool {
+	return m.MarkerStyle == MarkersGolangMigrate && strings.HasSuffix(file, ".down.sql")
+}
+
+// migrationStub is the content of a migration created by CreateMigration
+func (m *Migrator) migrationStub() string {
+	if m.MarkerStyle == MarkersGolangMigrate {
+		return ""
+	}
+	up, down := m.markers()
+	return up + "\n\n" + down + "\n"
+}
@@ -1,17 +1,17 @@
 package pgmigrate
 
 import (
-	"database/sql"
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"text/template"
 	"time"
 
-	"github.com/jedib0t/go-pretty/table"
 	"github.com/jmoiron/sqlx"
 
 	// import pg lib
@@ -23,6 +23,256 @@ type Migrator struct {
 	Conn         string // pg connection string
 	Table        string // table to store applied migrations: default migrations
 	MigrationDir string // relative directory holding the migrations: default migrations
+	Schema       string // schema set as search_path of the connection: optional
+
+	// Tenants are the schemas of the tenants of a database sharded by
+	// schema, split among shards by MigrateShard
+	Tenants []string
+
+	// DB is an existing connection pool to use instead of connecting with
+	// Conn; it is left open. Runs take a session-level advisory lock and
+	// set up the session, so the pool must be limited to one connection
+	// (SetMaxOpenConns(1)). Conn-based settings (UseService, Schema) don't
+	// apply to it. See WithConnection.
+	DB *sqlx.DB
+
+	// UseService resolves a Conn of the form "service=<name> ..." against the
+	// PostgreSQL service file ($PGSERVICEFILE or ~/.pg_service.conf).
+	// Parameters given in Conn override those of the service.
+	UseService bool
+
+	// MigrationIDPrefix namespaces migrations when several services share a
+	// migrations table: ids are stored as <prefix>/<file> and CreateMigration
+	// names files <prefix>_<timestamptz>_<some-name>.pgsql
+	MigrationIDPrefix string
+
+	// NamePattern is a regular expression every name passed to
+	// CreateMigration must match, e.g. `^JIRA-[0-9]+_[a-z_]+$`
+	NamePattern string
+	// NamePrefix is prepended to names passed to CreateMigration that don't
+	// already start with it. It is applied before NamePattern is checked.
+	NamePrefix string
+
+	// Template is a text/template CreateMigration writes new migrations
+	// with, executed with a TemplateData, e.g. to start them with a license
+	// comment; TemplateFile is the path of a file holding one. Template
+	// takes precedence; without either, migrations get the up/down stub.
+	Template     string
+	TemplateFile string
+
+	Messages       Messages    // status labels of the printed table: default DefaultMessages
+	DisplayIDWidth int         // ids longer than this are shortened in the printed table: 0 keeps them whole
+	Logger         *log.Logger // destination of warnings and retries: default the log package
+
+	// MarkerStyle selects the convention separating the up part of a
+	// migration from its down part: default MarkersPgmigrate. UpMarker and
+	// DownMarker, when set, replace the marker lines of the style.
+	MarkerStyle MarkerStyle
+	UpMarker    string
+	DownMarker  string
+
+	// AnalyzeVacuum runs VACUUM ANALYZE instead of ANALYZE for the tables of
+	// "-- pgmigrate:analyze <table>" directives. AnalyzeStrict fails the run
+	// when that fails instead of logging a warning.
+	AnalyzeVacuum bool
+	AnalyzeStrict bool
+
+	// SplitStatements executes the statements of a migration one at a time
+	// instead of sending the file in a single call. Quoted strings,
+	// dollar-quoted bodies and comments are respected, so function bodies
+	// and COPY ... FROM PROGRAM commands are passed through intact.
+	SplitStatements bool
+	// MaxStatements fails migrations executed statement by statement (see
+	// SplitStatements) that hold more statements, often a dump pasted by
+	// mistake: default 0, no limit
+	MaxStatements int
+
+	// WarnUnterminated logs a warning for migrations whose last statement
+	// has no semicolon, a sign the file may have been truncated. The
+	// statement still runs.
+	WarnUnterminated bool
+
+	// IsolateSessions resets the session between two migrations of a run,
+	// as DISCARD ALL would but keeping the lock of the run, then sets it up
+	// again (SessionVars, AfterConnect, search_path). Session state left by a
+	// migration, e.g. a SET that should have been SET LOCAL, can then not
+	// affect the next ones. It costs a few round trips per migration and
+	// drops the prepared statements and cached plans of the session.
+	IsolateSessions bool
+
+	// CheckForwardReferences fails a run before it applies anything when a
+	// pending migration seems to use an object created by a later pending
+	// one: see ForwardReferences for the limits of this heuristic
+	CheckForwardReferences bool
+
+	Pause time.Duration // wait between two migrations applied by a run: see PauseAfterEach
+
+	// MaxPerMinute caps the migrations a run starts per minute by spacing
+	// them evenly: see MigrateWithRateLimit. 0 means no limit.
+	MaxPerMinute int
+
+	// MinFreeDiskMB makes a run fail before connecting when the disk of
+	// MigrationDir has less free space: see CheckDiskSpace
+	MinFreeDiskMB int64
+
+	// UseSemanticVersioning orders migrations by the vMAJOR.MINOR prefix of
+	// their file name, e.g. v2.3_add_column.pgsql, instead of their path;
+	// every migration must have one. See MigrateToVersion.
+	UseSemanticVersioning bool
+
+	// MaxReplicationLagBytes makes a run fail before applying anything when
+	// a replica lags further behind: see CheckReplicationLag. 0 disables
+	// the check.
+	MaxReplicationLagBytes int64
+
+	// PoolerSafe makes runs work through a connection pooler in transaction
+	// mode, e.g. PgBouncer, where consecutive transactions of a connection
+	// may use different server sessions, by relying on no session state:
+	//   - runs are serialized by a lock row in the table <Table>_lock, taken
+	//     with SELECT ... FOR UPDATE, instead of an advisory lock. It is
+	//     leased for 10 minutes and renewed before each migration, so a run
+	//     that dies holds it up to that long, and a single migration running
+	//     longer may let another run in.
+	//   - SessionVars are set with SET LOCAL in the transaction of each
+	//     migration instead of once per session. No-transaction migrations
+	//     and phases run without them and can't have role or lock-timeout
+	//     headers; transactional phases get them.
+	//   - Schema can't be set: set the search_path of the role or database
+	//     (ALTER ROLE ... SET search_path) instead.
+	//   - queries with parameters use the unnamed statement
+	//     (binary_parameters=yes), no server-side prepared statements.
+	//   - a migration starting with SET search_path gets no special
+	//     treatment, use SET LOCAL; IsolateSessions and MonitorLongRunning
+	//     have no effect.
+	// AfterConnect and BeforeMigration must not rely on session state either.
+	// The other features work as usual.
+	PoolerSafe bool
+
+	// Environment selects the variants of migrations named
+	// <name>.<Environment>.pgsql over their base <name>.pgsql; variants of
+	// other environments are ignored, with a warning when Environment is
+	// not set. Variants are tracked under the id of the base variant, so
+	// only one of them is ever applied.
+	Environment string
+
+	// ReleaseID identifies the deployment running the migrations, e.g. the
+	// application version. It is recorded with each migration the run
+	// applies and returned by History: optional.
+	ReleaseID string
+
+	// Fingerprint computes the SchemaFingerprint of the database at the end
+	// of each successful run and records it with the migrations the run
+	// applied: see RecordedFingerprint. Runs applying nothing record none.
+	Fingerprint bool
+
+	// LockFile is a file listing migration ids one per line. When set, runs
+	// apply only the migrations listed, in its order: see UpdateLockFile.
+	LockFile string
+
+	// Strategy selects the pending migrations a run applies: default
+	// ForwardStrategy, all of them
+	Strategy Strategy
+
+	// MaxParallel is the number of connections applying the migrations of a
+	// parallel group, or migrating the schemas of MigrateShard, at once:
+	// default 1. Consecutive migrations with the same
+	// "-- pgmigrate:parallel-group <name>" header form a group; they must be
+	// independent of each other as their order is not kept.
+	MaxParallel int
+
+	// TrackingOrder decides whether a migration is recorded before or after
+	// its SQL runs: default TrackAfter. It only matters for migrations with
+	// the no-transaction header; see TrackingOrder for the trade-offs.
+	TrackingOrder TrackingOrder
+
+	// ErrorPolicy decides whether a run stops at the first migration that
+	// fails, the default, or continues with the next ones: see ErrorPolicy
+	ErrorPolicy ErrorPolicy
+
+	// NotifyChannel, when set, is notified with the run id through the
+	// connection of the run once it succeeded, before the lock is released:
+	// see WaitForMigrations
+	NotifyChannel string
+
+	// SourceURL, when set to an http(s) URL, replaces MigrationDir with a zip,
+	// tar or tar.gz archive of migrations downloaded at the start of each run
+	SourceURL        string
+	SourceSHA256     string // expected hex sha256 of the archive: optional
+	SourceAuthHeader string // Authorization header sent with the download: optional
+	SourceRetries    int    // retries of a failed download: default 0
+
+	// LockRetries is how many more times a run tries to take the advisory
+	// lock serializing concurrent runs before failing with ErrLockContended,
+	// LockRetryBackoff apart (default 1s). Default 0 fails immediately.
+	LockRetries      int
+	LockRetryBackoff time.Duration
+	LockKey          int64 // advisory lock key overriding AdvisoryLockKey's derivation: optional
+
+	// FastPath ends runs with nothing to do right after connecting, with a
+	// single query instead of taking the lock, reading every tracking row
+	// and setting up the session for each migration. It only applies without
+	// repeatable migrations, with ChecksumIgnore and TrackAfter; otherwise,
+	// or when in doubt, the run proceeds as usual.
+	FastPath bool
+
+	// CacheTTL skips runs, without connecting, for CacheTTL after a
+	// successful run in this process on the same Conn and Table. The cache
+	// doesn't know about MigrationDir: don't use it when migrators with
+	// different migration directories share a database and table.
+	CacheTTL time.Duration
+
+	// HistoryConns are connection strings of databases the migrations are
+	// applied to first, e.g. staging, whose recorded durations
+	// EstimateDuration uses
+	HistoryConns []string
+
+	// TemplateDB is the database cloned by ValidateOnTemplate to try the
+	// pending migrations on, typically a copy of production
+	TemplateDB string
+
+	// ChecksumPolicy decides whether a run compares applied migrations with
+	// their recorded checksum before applying new ones: default ChecksumIgnore
+	ChecksumPolicy ChecksumPolicy
+
+	// NormalizeLineEndings converts CRLF line endings of migration files to
+	// LF before they are hashed and executed, so a file checked out on
+	// Windows and on Unix gets the same checksum: see ChecksumFile
+	NormalizeLineEndings bool
+
+	// SessionVars are run-time parameters (GUCs) set on the session after
+	// connecting, e.g. {"timezone": "UTC"}: see SetSessionVariable
+	SessionVars map[string]string
+
+	// AfterConnect is called once per run right after the connection is
+	// established, before the migrations table is created and before any
+	// migration SQL is executed. Use it for session setup that can't be
+	// expressed in Conn (search_path, role, custom GUCs). Returning an error
+	// aborts the run.
+	AfterConnect func(ctx context.Context, db *sqlx.DB) error
+
+	// BeforeMigration is called inside the transaction of each pending
+	// migration before its SQL runs, so statements executed on tx share the
+	// migration's session and transaction (e.g. SET LOCAL of a tenant
+	// context). The transaction belongs to the Migrator: don't commit or roll
+	// it back. Migrations with the no-transaction header get a nil tx.
+	// Returning an error aborts the run.
+	BeforeMigration func(ctx context.Context, tx *sqlx.Tx, id string) error
+
+	// AfterMigration is called after each migration the run applied
+	// committed, with its Result, e.g. to log RowsAffected. Returning an
+	// error aborts the run; the migration stays applied.
+	AfterMigration func(ctx context.Context, result Result) error
+
+	// Tracer, when set, traces runs with a span per step and migration:
+	// see Tracer
+	Tracer Tracer
+
+	active        *activeRuns                   // runs abortable through RollbackOnSignal
+	templates     map[string]*template.Template // added with RegisterTemplate
+	runID         string                        // id of the next run, generated by it if empty
+	monitored     bool                          // label sessions for MonitorLongRunning
+	noRepeatables bool                          // runs apply the selected migrations only
+	plan          []plannedMigration            // set by ApplyPlan: the migrations a run must apply
 }
 
 // DefaultMigrator constructs a Migrator with default values
@@ -34,69 +284,425 @@ func DefaultMigrator(conn string) *Migrator {
 	}
 }
 
-// Migrate executes migrations specified in the migration directory
+// Migrate executes migrations specified in the migration directory.
+// It calls MigrateToLatest.
 func (m *Migrator) Migrate() error {
-	db, err := sqlx.Connect("postgres", m.Conn)
+	return m.MigrateToLatest()
+}
+
+// MigrateToLatest applies all pending migrations. It states the intent of
+// Migrate explicitly: should the defaults of Migrate ever change, this keeps
+// applying everything that is pending.
+func (m *Migrator) MigrateToLatest() error {
+	return m.MigrateContext(context.Background())
+}
+
+// MigrateContext is like Migrate but honours ctx for connecting and
+// executing migrations
+func (m *Migrator) MigrateContext(ctx context.Context) error {
+	results, err := m.MigrateResults(ctx)
 	if err != nil {
 		return err
 	}
-	t := table.NewWriter()
+	t := m.resultTable(results)
 	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"migration", "status"})
-	defer db.Close()
+	t.Render()
+	return nil
+}
+
+// MigrateRender executes migrations like MigrateContext and returns the
+// rendered migration table instead of printing it. The table is returned
+// even if a migration fails, along with the error.
+func (m *Migrator) MigrateRender(ctx context.Context) (string, error) {
+	results, err := m.MigrateResults(ctx)
+	return m.resultTable(results).Render(), err
+}
+
+// MigrateResults executes migrations like MigrateContext but returns the
+// outcome of each migration instead of printing it. On failure the results
+// of the migrations processed before the error are returned with it.
+func (m *Migrator) MigrateResults(ctx context.Context) ([]Result, error) {
+	if m.cached() {
+		return nil, nil
+	}
+	if m.MinFreeDiskMB > 0 {
+		if err := m.CheckDiskSpace(m.MinFreeDiskMB * 1024 * 1024); err != nil {
+			return nil, migrationError(StageConnect, "", err)
+		}
+	}
+	if m.isRemoteSource() {
+		dir, err := m.fetchSource(ctx)
+		if err != nil {
+			return nil, migrationError(StageRead, "", err)
+		}
+		defer os.RemoveAll(dir)
+		local := *m
+		local.SourceURL = ""
+		local.MigrationDir = dir
+		return local.MigrateResults(ctx)
+	}
+	ctx, span := m.startSpan(ctx, "pgmigrate.migrate")
+	results, err := m.run(ctx)
+	span.End(err)
+	return results, err
+}
+
+// run executes the migrations of MigrateResults
+func (m *Migrator) run(ctx context.Context) ([]Result, error) {
+	connectCtx, span := m.startSpan(ctx, "pgmigrate.connect")
+	db, err := m.connect(connectCtx)
+	span.End(err)
+	if err != nil {
+		return nil, migrationError(StageConnect, "", err)
+	}
+	defer m.close(db)
+	if m.FastPath {
+		if results, ok := m.upToDate(ctx, db); ok {
+			m.markSuccess()
+			return results, nil
+		}
+	}
+	lockCtx, span := m.startSpan(ctx, "pgmigrate.lock")
+	err = m.acquireLock(lockCtx, db)
+	span.End(err)
+	if err != nil {
+		return nil, migrationError(StageLock, "", err)
+	}
+	defer m.releaseLock(db)
+	if m.MaxReplicationLagBytes > 0 {
+		if err := checkReplicationLag(ctx, db, m.MaxReplicationLagBytes); err != nil {
+			return nil, migrationError(StageConnect, "", err)
+		}
+	}
+	ctx, untrack := m.track(ctx, db)
+	defer untrack()
 	err = createMigrationsTableIfNotExists(db, m.Table)
 	if err != nil {
-		return err
+		return nil, migrationError(StageCreateTable, "", err)
 	}
-	files, err := getFiles(m.MigrationDir)
+	files, err := m.migrationFiles()
 	if err != nil {
-		return err
+		return nil, migrationError(StageRead, "", err)
 	}
-	for _, file := range files {
-		id := strings.Split(file, m.Table+"/")[1]
-		if rowExists(db, "SELECT * FROM "+m.Table+" WHERE id = $1", id) {
-			t.AppendRow(table.Row{id, "already applied"})
-			continue
+	path, err := newSessionPath(ctx, db)
+	if err != nil {
+		return nil, migrationError(StageConnect, "", err)
+	}
+	if path.tracked, err = m.tracked(ctx, db); err != nil {
+		return nil, migrationError(StageRead, "", err)
+	}
+	if m.ChecksumPolicy != ChecksumIgnore {
+		mismatches, err := m.checksumMismatches(path.tracked, files)
+		if err != nil {
+			return nil, migrationError(StageVerify, "", err)
+		}
+		if len(mismatches) > 0 && m.ChecksumPolicy == ChecksumFail {
+			return nil, migrationError(StageVerify, "", &ChecksumError{Mismatches: mismatches})
+		}
+		for _, c := range mismatches {
+			m.logf("warning: %s", c)
+		}
+	}
+	selected, err := m.selected(ctx, db, files)
+	if err != nil {
+		return nil, migrationError(StageRead, "", err)
+	}
+	if m.plan != nil {
+		if err := m.checkPlan(files, selected); err != nil {
+			return nil, migrationError(StageVerify, "", err)
+		}
+	}
+	if m.CheckForwardReferences {
+		var pending []string
+		for _, file := range files {
+			if selected[m.migrationID(file)] {
+				pending = append(pending, file)
+			}
 		}
-		f, err := os.Open(file)
+		refs, err := m.forwardReferences(pending)
 		if err != nil {
+			return nil, migrationError(StageRead, "", err)
+		}
+		if len(refs) > 0 {
+			return nil, migrationError(StageVerify, "", &ForwardReferenceError{References: refs})
+		}
+	}
+	runID := m.runID
+	if runID == "" {
+		if runID, err = newRunID(); err != nil {
+			return nil, err
+		}
+	}
+	var (
+		results   []Result
+		executed  bool      // a migration ran since the start of the run
+		lastStart time.Time // when the latest migration started
+		failures  []error   // migrations that failed under ContinueOnError
+	)
+	// failed returns err to stop the run, or nil to go on with the next
+	// migration under ContinueOnError
+	failed := func(err error) error {
+		if m.ErrorPolicy != ContinueOnError || ctx.Err() != nil {
 			return err
 		}
-		fcontent, err := ioutil.ReadAll(f)
+		m.logf("%v; continuing", err)
+		failures = append(failures, err)
+		return nil
+	}
+	for i := 0; i < len(files); i++ {
+		file := files[i]
+		id := m.migrationID(file)
+		if tracked, ok := path.applied(id); ok {
+			results = append(results, tracked)
+			continue
+		}
+		if err := m.useSearchPath(ctx, db, file, path); err != nil {
+			return results, migrationError(StageExec, id, err)
+		}
+		if tracked, err := m.trackedResult(ctx, db, id); err != nil || tracked.ID != "" {
+			if err != nil {
+				return results, migrationError(StageRead, id, err)
+			}
+			results = append(results, tracked)
+			continue
+		}
+		if !selected[id] {
+			continue
+		}
+		group, size, err := m.groupSpan(files[i:])
 		if err != nil {
-			return err
+			return results, migrationError(StageRead, id, err)
+		}
+		if executed {
+			if err := pause(ctx, m.throttle(lastStart)); err != nil {
+				return results, migrationError(StageExec, id, err)
+			}
+			if m.IsolateSessions {
+				if err := m.isolate(ctx, db, file, path); err != nil {
+					return results, migrationError(StageExec, id, err)
+				}
+			}
+		}
+		executed = true
+		lastStart = time.Now()
+		if group != "" {
+			// the consecutive pending migrations of the group run together,
+			// after everything sorted before them and before the rest
+			groupFiles, groupIDs := []string{file}, []string{id}
+			for end := i + size; i+1 < end; i++ {
+				next := m.migrationID(files[i+1])
+				if tracked, ok := path.applied(next); ok {
+					results = append(results, tracked)
+					continue
+				}
+				if err := m.useSearchPath(ctx, db, files[i+1], path); err != nil {
+					return results, migrationError(StageExec, next, err)
+				}
+				if tracked, err := m.trackedResult(ctx, db, next); err != nil || tracked.ID != "" {
+					if err != nil {
+						return results, migrationError(StageRead, next, err)
+					}
+					results = append(results, tracked)
+					continue
+				}
+				if !selected[next] {
+					continue
+				}
+				groupFiles = append(groupFiles, files[i+1])
+				groupIDs = append(groupIDs, next)
+			}
+			groupResults, err := m.applyGroup(ctx, group, groupFiles, groupIDs, runID)
+			results = append(results, groupResults...)
+			if err != nil {
+				if err := failed(err); err != nil {
+					return results, err
+				}
+			}
+			continue
+		}
+		result, err := m.apply(ctx, db, file, id, runID)
+		path.forget()
+		if result.ID != "" {
+			results = append(results, result)
 		}
-		txn := db.MustBegin()
-		_, err = txn.Exec(string(fcontent))
 		if err != nil {
-			err = txn.Rollback()
-			return err
+			if err := failed(err); err != nil {
+				return results, err
+			}
+		}
+	}
+	var repeatables []string
+	if !m.noRepeatables {
+		if repeatables, err = m.repeatableFiles(); err != nil {
+			return results, migrationError(StageRead, "", err)
+		}
+	}
+	for _, file := range repeatables {
+		if m.IsolateSessions && executed {
+			if err := m.isolate(ctx, db, file, path); err != nil {
+				return results, migrationError(StageExec, m.migrationID(file), err)
+			}
+		}
+		executed = true
+		if err := m.useSearchPath(ctx, db, file, path); err != nil {
+			return results, migrationError(StageExec, m.migrationID(file), err)
+		}
+		result, err := m.apply(ctx, db, file, m.migrationID(file), runID)
+		path.forget()
+		if result.ID != "" {
+			results = append(results, result)
 		}
-		_, err = txn.Exec("INSERT INTO "+m.Table+" (id) VALUES ($1)", id)
 		if err != nil {
-			err = txn.Rollback()
-			return err
+			if err := failed(err); err != nil {
+				return results, err
+			}
 		}
-		txn.Commit()
-		t.AppendRow(table.Row{id, "applied now"})
-		f.Close()
 	}
-	t.Render()
+	if len(failures) > 0 {
+		return results, &RunError{Errors: failures}
+	}
+	if m.Fingerprint {
+		if err := m.recordFingerprint(ctx, db, runID); err != nil {
+			return results, migrationError(StageTrack, "", err)
+		}
+	}
+	if m.NotifyChannel != "" {
+		if _, err := db.ExecContext(ctx, "SELECT pg_notify($1, $2)", m.NotifyChannel, runID); err != nil {
+			return results, migrationError(StageTrack, "", err)
+		}
+	}
+	m.markSuccess()
+	return results, nil
+}
+
+// Healthz is a lightweight readiness check: it verifies within two seconds
+// that the database is reachable and the migrations table exists, without
+// reading the migration directory
+func (m *Migrator) Healthz() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	db, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.close(db)
+	var exists bool
+	err = db.QueryRowxContext(ctx, "SELECT to_regclass($1) IS NOT NULL", m.Table).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("migrations table %s does not exist", m.Table)
+	}
 	return nil
 }
 
-func getFiles(path string) ([]string, error) {
-	var files []string
+// connect opens the single connection used for a run, or returns DB, and
+// applies the session setup configured on the Migrator. Release it with
+// m.close.
+func (m *Migrator) connect(ctx context.Context) (*sqlx.DB, error) {
+	db := m.DB
+	if db == nil {
+		dsn, err := m.dsn()
+		if err != nil {
+			return nil, err
+		}
+		db, err = sqlx.ConnectContext(ctx, "postgres", dsn)
+		if err != nil {
+			return nil, err
+		}
+		// session setup only sticks if every statement uses the same connection
+		db.SetMaxOpenConns(1)
+	}
+	if !m.PoolerSafe {
+		if err := m.setSessionVars(ctx, db); err != nil {
+			m.close(db)
+			return nil, err
+		}
+	}
+	if m.AfterConnect != nil {
+		if err := m.AfterConnect(ctx, db); err != nil {
+			m.close(db)
+			return nil, err
+		}
+	}
+	return db, nil
+}
 
-	base, err := filepath.Rel(filepath.Base("."), path)
+// close closes a db returned by connect unless it is the caller's DB
+func (m *Migrator) close(db *sqlx.DB) {
+	if db != m.DB {
+		db.Close()
+	}
+}
+
+// migrationID returns the id a migration file is tracked under, that of
+// its base variant for environment variants
+func (m *Migrator) migrationID(file string) string {
+	file, _ = m.splitVariant(file)
+	dir := filepath.ToSlash(filepath.Clean(m.MigrationDir)) + "/"
+	id := strings.TrimPrefix(filepath.ToSlash(file), dir)
+	if m.MigrationIDPrefix != "" {
+		id = m.MigrationIDPrefix + "/" + id
+	}
+	return id
+}
+
+// migrationFile returns the path of the migration tracked as id
+func (m *Migrator) migrationFile(id string) (string, error) {
+	files, err := m.migrationFiles()
 	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if m.migrationID(file) == id {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("migration %s not found in %s", id, m.MigrationDir)
+}
+
+// migrationFiles lists the migrations of MigrationDir in the order they
+// are applied: that of LockFile when set
+func (m *Migrator) migrationFiles() ([]string, error) {
+	files, err := m.directoryFiles()
+	if err != nil || m.LockFile == "" {
 		return files, err
 	}
-	err = filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+	return m.lockedFiles(files)
+}
+
+// directoryFiles lists the migrations of MigrationDir in path order, or
+// version order under UseSemanticVersioning
+func (m *Migrator) directoryFiles() ([]string, error) {
+	files, err := getFiles(m.MigrationDir)
+	if err != nil {
+		return nil, err
+	}
+	migrations := files[:0]
+	for _, file := range files {
+		if !m.isDownFile(file) && !m.isRepeatable(file) && !m.isInclude(file) && !m.isSavedTemplate(file) {
+			migrations = append(migrations, file)
+		}
+	}
+	migrations = m.resolveVariants(migrations)
+	if m.UseSemanticVersioning {
+		if err := m.sortByVersion(migrations); err != nil {
+			return nil, err
+		}
+	}
+	return migrations, nil
+}
+
+func getFiles(path string) ([]string, error) {
+	var files []string
+
+	base := filepath.Clean(path)
+	err := filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() {
+		if !info.IsDir() && info.Name() != keepFile {
 			files = append(files, path)
 		}
 		return nil
@@ -105,38 +711,161 @@ func getFiles(path string) ([]string, error) {
 
 }
 
-func rowExists(db *sqlx.DB, query string, args ...interface{}) bool {
-	var exists bool
-	query = fmt.Sprintf("SELECT exists (%s)", query)
-	err := db.QueryRow(query, args...).Scan(&exists)
-	if err != nil && err != sql.ErrNoRows {
-		log.Fatalf("error checking if row exists '%s' %v", args, err)
+func createMigrationsTableIfNotExists(db *sqlx.DB, table string) error {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS " + table + " (id VARCHAR PRIMARY KEY)")
+	if err != nil {
+		return err
 	}
-	return exists
+	return upgradeMigrationsTable(db, table)
 }
 
-func createMigrationsTableIfNotExists(db *sqlx.DB, table string) error {
-	_, err := db.Exec("CREATE TABLE IF NOT EXISTS " + table + " (id VARCHAR PRIMARY KEY)")
-	return err
+// trackingColumns are the columns added to the migrations table after its
+// initial (id) version. They are nullable so existing rows stay valid.
+var trackingColumns = []string{
+	"checksum VARCHAR",       // sha256 of the applied content
+	"applied_at TIMESTAMPTZ", // when the migration was committed
+	"duration_ms BIGINT",     // execution time of the migration SQL
+	"applied_by VARCHAR",     // database user that applied it
+	"run_id VARCHAR",         // identifies the Migrate call that applied it
+	"status VARCHAR",         // NULL when applied, 'skipped' after Skip, 'dirty' while partially applied
+	"phase INT",              // phases of a multi-phase migration done so far
+	"release_id VARCHAR",     // ReleaseID of the run that applied it
+	"fingerprint VARCHAR",    // SchemaFingerprint at the end of that run, with Fingerprint
+}
+
+// upgradeMigrationsTable adds the tracking columns missing from table
+func upgradeMigrationsTable(db *sqlx.DB, table string) error {
+	for _, column := range trackingColumns {
+		_, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN IF NOT EXISTS " + column)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // CreateMigration creates migration in the specified MigrationDir
 // The migration created has the following format:
 // <timestamptz>_<some-name>.pgsql
+// Its content is Template or TemplateFile executed, when set, else a stub
+// with the up and down markers.
 func (m *Migrator) CreateMigration(name string) error {
+	t, err := m.fileTemplate()
+	if err != nil {
+		return err
+	}
+	if t != nil {
+		return m.createMigrationFromTemplate(name, t)
+	}
+	_, err = m.createMigration(name, m.migrationStub())
+	return err
+}
+
+// CreateMigrationWithContent is like CreateMigration but writes content to
+// the new migration
+func (m *Migrator) CreateMigrationWithContent(name, content string) error {
+	_, err := m.createMigration(name, content)
+	return err
+}
+
+// createMigration writes a new migration and returns its path
+func (m *Migrator) createMigration(name, content string) (string, error) {
+	path, err := m.newMigrationPath(name)
+	if err != nil {
+		return "", err
+	}
+	return path, writeMigration(path, content)
+}
+
+// newMigrationPath returns the path of a new migration called name
+func (m *Migrator) newMigrationPath(name string) (string, error) {
 	if name == "" {
-		return errors.New("missing migration name")
+		return "", errors.New("missing migration name")
 	}
-	base, err := filepath.Rel(filepath.Base("."), m.MigrationDir)
+	name, err := m.migrationName(name)
 	if err != nil {
-		return err
+		return "", err
 	}
+	base := filepath.Clean(m.MigrationDir)
 	filename := time.Now().Format(time.RFC3339Nano) + "_" + name + ".pgsql"
-	f, err := os.OpenFile(base+"/"+filename, os.O_CREATE, os.ModePerm)
+	if m.MigrationIDPrefix != "" {
+		filename = m.MigrationIDPrefix + "_" + filename
+	}
+	return filepath.Join(base, filename), nil
+}
+
+// writeMigration creates the migration at path, which must not exist yet
+func writeMigration(path, content string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.ModePerm)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("created migration %s\n", filename)
 	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		return err
+	}
+	fmt.Printf("created migration %s\n", filepath.Base(path))
 	return nil
 }
+
+// initialMigration is the content of the migration scaffolded by Init
+const initialMigration = `-- pgmigrate: description: baseline extensions
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+`
+
+// Init prepares a new project: it creates MigrationDir if missing and, only
+// when it holds no migrations yet, scaffolds a first migration enabling
+// baseline extensions. It returns the path of the scaffolded migration, or
+// "" when migrations already existed and nothing was written.
+func (m *Migrator) Init() (string, error) {
+	if err := os.MkdirAll(m.MigrationDir, 0755); err != nil {
+		return "", err
+	}
+	files, err := m.migrationFiles()
+	if err != nil {
+		return "", err
+	}
+	if len(files) > 0 {
+		return "", nil
+	}
+	return m.createMigration("init", initialMigration)
+}
+
+// keepFile is the empty file CreateMigrationDir writes so that version
+// control tracks MigrationDir while it holds no migrations; it is ignored
+const keepFile = ".keep"
+
+// CreateMigrationDir creates MigrationDir if missing with an empty .keep
+// file, so that it is committed to version control before it holds any
+// migration. Existing files, .keep included, are left untouched.
+func (m *Migrator) CreateMigrationDir() error {
+	if err := os.MkdirAll(m.MigrationDir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(m.MigrationDir, keepFile), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// migrationName applies NamePrefix and checks the result against NamePattern
+func (m *Migrator) migrationName(name string) (string, error) {
+	if m.NamePrefix != "" && !strings.HasPrefix(name, m.NamePrefix) {
+		name = m.NamePrefix + name
+	}
+	if m.NamePattern == "" {
+		return name, nil
+	}
+	re, err := regexp.Compile(m.NamePattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid name pattern %q: %v", m.NamePattern, err)
+	}
+	if !re.MatchString(name) {
+		return "", fmt.Errorf("migration name %q does not match pattern %q", name, m.NamePattern)
+	}
+	return name, nil
+}
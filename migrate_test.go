@@ -0,0 +1,45 @@
+package pgmigrate
+
+import "testing"
+
+// migrateFiles are two migrations, the second depending on the first
+var migrateFiles = map[string]string{
+	"0001_orders.pgsql": "CREATE TABLE orders (id int PRIMARY KEY);\n",
+	"0002_items.pgsql":  "CREATE TABLE items (order_id int REFERENCES orders);\n",
+}
+
+// checkMigrated fails unless both migrateFiles are applied and recorded
+func checkMigrated(t *testing.T, m *Migrator) {
+	t.Helper()
+	var tables, tracked int
+	testQuery(t, m, &tables, "SELECT count(*) FROM pg_tables WHERE schemaname = $1 AND tablename IN ('orders', 'items')", m.Schema)
+	testQuery(t, m, &tracked, "SELECT count(*) FROM "+m.Table)
+	if tables != 2 || tracked != 2 {
+		t.Errorf("%d tables created and %d migrations recorded, want 2 and 2", tables, tracked)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	m := testMigrator(t, migrateFiles)
+	if err := m.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	checkMigrated(t, m)
+	// nothing is pending the second time
+	if err := m.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	checkMigrated(t, m)
+}
+
+func TestMigrateToLatest(t *testing.T) {
+	m := testMigrator(t, migrateFiles)
+	if err := m.MigrateToLatest(); err != nil {
+		t.Fatal(err)
+	}
+	checkMigrated(t, m)
+	if err := m.MigrateToLatest(); err != nil {
+		t.Fatal(err)
+	}
+	checkMigrated(t, m)
+}
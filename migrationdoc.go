@@ -0,0 +1,50 @@
+package pgmigrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// GenerateMigrationDoc writes a Markdown document describing every
+// migration to outputPath: one section per migration headed by its id,
+// with its description header and its SQL in a fenced block. Migrations
+// already applied to the database are marked with ✓.
+func (m *Migrator) GenerateMigrationDoc(outputPath string) error {
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.close(db)
+	applied, err := m.appliedIDs(ctx, db)
+	if err != nil {
+		return err
+	}
+	files, err := m.migrationFiles()
+	if err != nil {
+		return err
+	}
+
+	var doc bytes.Buffer
+	doc.WriteString("# Migrations\n")
+	for _, file := range files {
+		id := m.migrationID(file)
+		content, err := m.readMigration(file)
+		if err != nil {
+			return err
+		}
+		heading := id
+		if applied[id] {
+			heading += " ✓"
+		}
+		fmt.Fprintf(&doc, "\n## %s\n\n", heading)
+		if description := parseHeaders(content)["description"]; description != "" {
+			fmt.Fprintf(&doc, "%s\n\n", description)
+		}
+		fmt.Fprintf(&doc, "```sql\n%s\n```\n", strings.TrimSpace(string(content)))
+	}
+	return ioutil.WriteFile(outputPath, doc.Bytes(), 0644)
+}
@@ -0,0 +1,105 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// applicationNamePrefix prefixes the application_name of the session while
+// it applies a migration under MonitorLongRunning
+const applicationNamePrefix = "pgmigrate:"
+
+// monitorInterval is how often MonitorLongRunning polls pg_stat_activity
+const monitorInterval = 5 * time.Second
+
+// MonitorLongRunning makes runs of m started after this call label their
+// session with the id of the migration being applied in application_name,
+// and starts polling pg_stat_activity every 5 seconds on a connection of its
+// own, opened with Conn, until ctx is cancelled. handler is called once per
+// migration that has been running for longer than threshold, with its id
+// and how long it has been running, e.g. to raise an alert about a blocked
+// lock. Cancel ctx once Migrate returned:
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	m.MonitorLongRunning(ctx, time.Minute, alert)
+//	err := m.Migrate()
+//	cancel()
+//
+// application_name is limited to 63 bytes, so longer ids are reported
+// truncated. Polling errors are logged and retried at the next poll.
+func (m *Migrator) MonitorLongRunning(ctx context.Context, threshold time.Duration, handler func(id string, duration time.Duration)) {
+	m.monitored = true
+	monitor := *m
+	monitor.DB = nil
+	go monitor.monitor(ctx, threshold, handler)
+}
+
+func (m *Migrator) monitor(ctx context.Context, threshold time.Duration, handler func(id string, duration time.Duration)) {
+	var (
+		db       *sqlx.DB
+		reported = make(map[string]bool) // backend pid and migration
+		ticker   = time.NewTicker(monitorInterval)
+	)
+	defer ticker.Stop()
+	defer func() {
+		if db != nil {
+			db.Close()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if db == nil {
+			dsn, err := m.dsn()
+			if err == nil {
+				db, err = sqlx.ConnectContext(ctx, "postgres", dsn)
+			}
+			if err != nil {
+				m.logf("monitor long-running migrations: %v", err)
+				continue
+			}
+		}
+		var running []struct {
+			PID     int    `db:"pid"`
+			Name    string `db:"application_name"`
+			Elapsed int64  `db:"elapsed_ms"`
+		}
+		err := db.SelectContext(ctx, &running, `
+			SELECT pid, application_name,
+				(extract(epoch FROM now() - coalesce(xact_start, query_start)) * 1000)::bigint AS elapsed_ms
+			FROM pg_stat_activity
+			WHERE application_name LIKE $1 AND state <> 'idle'`, applicationNamePrefix+"%")
+		if err != nil {
+			if ctx.Err() == nil {
+				m.logf("monitor long-running migrations: %v", err)
+			}
+			continue
+		}
+		for _, r := range running {
+			elapsed := time.Duration(r.Elapsed) * time.Millisecond
+			key := fmt.Sprintf("%d %s", r.PID, r.Name)
+			if elapsed <= threshold || reported[key] {
+				continue
+			}
+			reported[key] = true
+			handler(strings.TrimPrefix(r.Name, applicationNamePrefix), elapsed)
+		}
+	}
+}
+
+// labelSession sets the application_name of db to the migration id for
+// MonitorLongRunning
+func (m *Migrator) labelSession(ctx context.Context, db *sqlx.DB, id string) error {
+	if !m.monitored || m.PoolerSafe {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, "SELECT set_config('application_name', $1, false)", applicationNamePrefix+id)
+	return err
+}
@@ -0,0 +1,69 @@
+package pgmigrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DoneChannel is the channel MigrateWithNotifications notifies with the id
+// of the run once it applied the migrations
+const DoneChannel = "pgmigrate:done"
+
+// MigrateWithNotifications executes the migrations like Migrate, then sends
+// pg_notify on DoneChannel through conn with the run id as payload. Other
+// instances can LISTEN on DoneChannel and reload their migration state when
+// notified instead of queueing for the advisory lock. Nothing is sent when
+// the run fails.
+func (m *Migrator) MigrateWithNotifications(conn *pq.ListenerConn) error {
+	runID, err := newRunID()
+	if err != nil {
+		return err
+	}
+	local := *m
+	local.runID = runID
+	if err := local.MigrateContext(context.Background()); err != nil {
+		return err
+	}
+	_, err = conn.ExecSimpleQuery("SELECT pg_notify(" + pq.QuoteLiteral(DoneChannel) + ", " + pq.QuoteLiteral(runID) + ")")
+	return err
+}
+
+// WaitForMigrations blocks until no migration of MigrationDir is pending,
+// e.g. for instances that start the application while another instance
+// migrates. It listens on NotifyChannel, DoneChannel if unset, on a
+// connection of its own opened with Conn and checks Stats again each time a
+// run notifies it, so runs must set NotifyChannel or use
+// MigrateWithNotifications. It returns right away when nothing is pending.
+func (m *Migrator) WaitForMigrations(ctx context.Context) error {
+	channel := m.NotifyChannel
+	if channel == "" {
+		channel = DoneChannel
+	}
+	dsn, err := m.dsn()
+	if err != nil {
+		return err
+	}
+	listener := pq.NewListener(dsn, time.Second, time.Minute, nil)
+	defer listener.Close()
+	if err := listener.Listen(channel); err != nil {
+		return err
+	}
+	for {
+		// listening first: a run finishing now notifies us or is counted
+		stats, err := m.Stats(ctx)
+		if err != nil {
+			return err
+		}
+		if stats.Pending == 0 {
+			return nil
+		}
+		// a nil notification after a reconnect also checks again
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-listener.Notify:
+		}
+	}
+}
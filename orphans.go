@@ -0,0 +1,108 @@
+package pgmigrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// orphanCandidatesQuery lists the tables, views, functions and triggers owned
+// by the current user outside the system schemas, with the commit time of
+// their catalog row when track_commit_timestamp is on
+const orphanCandidatesQuery = `
+WITH objects AS (
+	SELECT n.nspname AS schema_name, c.relname AS object_name, n.nspname || '.' || c.relname AS qualified_name, c.xmin AS xid
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f') AND c.relowner = (SELECT oid FROM pg_roles WHERE rolname = current_user)
+	UNION ALL
+	SELECT n.nspname, p.proname, n.nspname || '.' || p.proname, p.xmin
+	FROM pg_proc p
+	JOIN pg_namespace n ON n.oid = p.pronamespace
+	WHERE p.proowner = (SELECT oid FROM pg_roles WHERE rolname = current_user)
+	UNION ALL
+	SELECT n.nspname, t.tgname, n.nspname || '.' || c.relname || '.' || t.tgname, t.xmin
+	FROM pg_trigger t
+	JOIN pg_class c ON c.oid = t.tgrelid
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE NOT t.tgisinternal AND c.relowner = (SELECT oid FROM pg_roles WHERE rolname = current_user)
+)
+SELECT object_name, qualified_name,
+	CASE WHEN current_setting('track_commit_timestamp') = 'on' THEN pg_xact_commit_timestamp(xid) END AS created_at
+FROM objects
+WHERE schema_name NOT IN ('information_schema') AND schema_name NOT LIKE 'pg\_%'
+ORDER BY qualified_name COLLATE "C"`
+
+// VerifyOrphanedObjects returns the schema-qualified names of the tables,
+// views, functions and triggers owned by the current user that no migration
+// file mentions (case-insensitive search of the name) and that were created
+// after the first migration was applied. Triggers are reported as
+// schema.table.trigger.
+//
+// Postgres doesn't record when an object was created: the commit time of its
+// catalog row is used, which requires track_commit_timestamp and moves when
+// the object is altered. Without it every unmentioned object is reported.
+// This is a heuristic for spotting objects created by hand, not a proof.
+func (m *Migrator) VerifyOrphanedObjects() ([]string, error) {
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close(db)
+
+	tracked, err := m.tracked(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	var since sql.NullTime
+	for _, row := range tracked {
+		if row.AppliedAt.Valid && (!since.Valid || row.AppliedAt.Time.Before(since.Time)) {
+			since = row.AppliedAt
+		}
+	}
+	if !since.Valid {
+		// nothing applied yet, so nothing can have been created after it
+		return nil, nil
+	}
+
+	files, err := getFiles(m.MigrationDir)
+	if err != nil {
+		return nil, err
+	}
+	var sqlText bytes.Buffer
+	for _, file := range files {
+		content, err := m.readMigration(file)
+		if err != nil {
+			return nil, err
+		}
+		sqlText.Write(bytes.ToLower(content))
+		sqlText.WriteByte('\n')
+	}
+	text := sqlText.String()
+
+	var objects []struct {
+		Name      string       `db:"object_name"`
+		Qualified string       `db:"qualified_name"`
+		CreatedAt sql.NullTime `db:"created_at"`
+	}
+	if err := db.SelectContext(ctx, &objects, orphanCandidatesQuery); err != nil {
+		return nil, err
+	}
+	table := strings.ToLower(m.Table)
+	var orphans []string
+	for _, o := range objects {
+		name := strings.ToLower(o.Name)
+		if name == table || strings.HasSuffix(table, "."+name) {
+			continue
+		}
+		if o.CreatedAt.Valid && !o.CreatedAt.Time.After(since.Time) {
+			continue
+		}
+		if !strings.Contains(text, name) {
+			orphans = append(orphans, o.Qualified)
+		}
+	}
+	return orphans, nil
+}
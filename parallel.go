@@ -0,0 +1,131 @@
+package pgmigrate
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// GroupError lists the migrations of a parallel group that failed with
+// their error
+type GroupError struct {
+	Group  string
+	Errors map[string]error
+}
+
+func (e *GroupError) Error() string {
+	ids := make([]string, 0, len(e.Errors))
+	for id := range e.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	msgs := make([]string, len(ids))
+	for i, id := range ids {
+		msgs[i] = e.Errors[id].Error()
+	}
+	return "parallel group " + e.Group + ": " + strings.Join(msgs, "; ")
+}
+
+// parallelGroup returns the parallel-group header of file, or ""
+func (m *Migrator) parallelGroup(file string) (string, error) {
+	content, err := m.readMigration(file)
+	if err != nil {
+		return "", err
+	}
+	return parseHeaders(content)["parallel-group"], nil
+}
+
+// groupSpan returns the parallel group of the first of files and the number
+// of consecutive files from it in that group, 1 without group
+func (m *Migrator) groupSpan(files []string) (string, int, error) {
+	group, err := m.parallelGroup(files[0])
+	if err != nil || group == "" {
+		return group, 1, err
+	}
+	n := 1
+	for ; n < len(files); n++ {
+		// an unreadable file ends the group and fails on its own turn
+		if g, err := m.parallelGroup(files[n]); err != nil || g != group {
+			break
+		}
+	}
+	return group, n, nil
+}
+
+// applyGroup applies the pending migrations files of a parallel group,
+// identified by ids, with up to MaxParallel workers each holding its own
+// connection. Every migration is attempted; the failed ones are returned in
+// a *GroupError while the others stay applied. Results keep the order of
+// files.
+func (m *Migrator) applyGroup(ctx context.Context, group string, files, ids []string, runID string) ([]Result, error) {
+	workers := m.MaxParallel
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(files) {
+		workers = len(files)
+	}
+	var (
+		mu      sync.Mutex
+		errs    = make(map[string]error)
+		results = make([]Result, len(files))
+		wg      sync.WaitGroup
+		queue   = make(chan int)
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var path *sessionPath
+			db, err := m.connect(ctx)
+			if err != nil {
+				err = migrationError(StageConnect, "", err)
+			} else {
+				defer m.close(db)
+				if path, err = newSessionPath(ctx, db); err != nil {
+					err = migrationError(StageConnect, "", err)
+				}
+			}
+			for i := range queue {
+				if err != nil {
+					// the worker has no connection: fail what it is handed
+					mu.Lock()
+					errs[ids[i]] = err
+					mu.Unlock()
+					continue
+				}
+				if err := m.useSearchPath(ctx, db, files[i], path); err != nil {
+					mu.Lock()
+					errs[ids[i]] = migrationError(StageExec, ids[i], err)
+					mu.Unlock()
+					continue
+				}
+				result, applyErr := m.apply(ctx, db, files[i], ids[i], runID)
+				path.forget()
+				mu.Lock()
+				results[i] = result
+				if applyErr != nil {
+					errs[ids[i]] = applyErr
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range files {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	var done []Result
+	for _, r := range results {
+		if r.ID != "" {
+			done = append(done, r)
+		}
+	}
+	if len(errs) > 0 {
+		return done, &GroupError{Group: group, Errors: errs}
+	}
+	return done, nil
+}
@@ -0,0 +1,70 @@
+package pgmigrate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGroupSpan(t *testing.T) {
+	m := DefaultMigrator("")
+	m.MigrationDir = testDir(t, map[string]string{
+		"0001_table.pgsql":   "CREATE TABLE t (a int, b int, c int);\n",
+		"0002_index_a.pgsql": "-- pgmigrate: parallel-group: indexes\nCREATE INDEX ON t (a);\n",
+		"0003_index_b.pgsql": "-- pgmigrate: parallel-group: indexes\nCREATE INDEX ON t (b);\n",
+		"0004_other.pgsql":   "-- pgmigrate: parallel-group: other\nCREATE INDEX ON t (c);\n",
+		"0005_index_c.pgsql": "-- pgmigrate: parallel-group: indexes\nCREATE INDEX ON t (a, b);\n",
+	})
+	files, err := m.migrationFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		from  int
+		group string
+		n     int
+	}{
+		{0, "", 1},
+		{1, "indexes", 2}, // the group ends at the first file of another
+		{2, "indexes", 1},
+		{3, "other", 1},
+		{4, "indexes", 1}, // the last file
+	}
+	for _, tt := range tests {
+		group, n, err := m.groupSpan(files[tt.from:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if group != tt.group || n != tt.n {
+			t.Errorf("groupSpan from %s = %q, %d, want %q, %d", m.migrationID(files[tt.from]), group, n, tt.group, tt.n)
+		}
+	}
+}
+
+func TestApplyGroup(t *testing.T) {
+	m := testMigrator(t, map[string]string{
+		"0001_table.pgsql":   "CREATE TABLE t (a int, b int, c int);\n",
+		"0002_index_a.pgsql": "-- pgmigrate: parallel-group: indexes\nCREATE INDEX t_a ON t (a);\n",
+		"0003_broken.pgsql":  "-- pgmigrate: parallel-group: indexes\nCREATE INDEX t_x ON t (x);\n",
+		"0004_index_b.pgsql": "-- pgmigrate: parallel-group: indexes\nCREATE INDEX t_b ON t (b);\n",
+		"0005_index_c.pgsql": "CREATE INDEX t_c ON t (c);\n",
+	})
+	m.MaxParallel = 2
+	results, err := m.MigrateResults(context.Background())
+	var groupErr *GroupError
+	if !errors.As(err, &groupErr) {
+		t.Fatalf("got error %v, want a *GroupError", err)
+	}
+	if _, ok := groupErr.Errors["0003_broken.pgsql"]; !ok || len(groupErr.Errors) != 1 {
+		t.Errorf("group errors %v, want 0003_broken.pgsql only", groupErr.Errors)
+	}
+	// the rest of the group stays applied, in file order; the run stops
+	var ids []string
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	if want := []string{"0001_table.pgsql", "0002_index_a.pgsql", "0004_index_b.pgsql"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("results %q, want %q", ids, want)
+	}
+}
@@ -0,0 +1,75 @@
+package pgmigrate
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"time"
+)
+
+// PauseAfterEach sets Pause, the time waited between two migrations applied
+// by the same run, to spread lock pressure on a live database. It is a
+// method so startup code can throttle conditionally.
+func (m *Migrator) PauseAfterEach(duration time.Duration) error {
+	if duration < 0 {
+		return errors.New("pause must not be negative")
+	}
+	m.Pause = duration
+	return nil
+}
+
+// pause waits for d unless ctx ends first; the wait counts toward the
+// run's deadline
+func pause(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// MigrateWithRateLimit executes the migrations starting at most
+// migrationsPerMinute of them per minute, evenly spaced, to keep a long
+// series from saturating the I/O of a busy database. Each migration waits
+// only for what is left of its slot after the previous one, and at least
+// Pause. migrationsPerMinute <= 0 disables the limit.
+func (m *Migrator) MigrateWithRateLimit(migrationsPerMinute int) error {
+	limited := *m
+	limited.MaxPerMinute = migrationsPerMinute
+	return limited.MigrateContext(context.Background())
+}
+
+// throttle returns how long to wait before the next migration of a run
+// whose previous migration started at lastStart
+func (m *Migrator) throttle(lastStart time.Time) time.Duration {
+	wait := m.Pause
+	if m.MaxPerMinute > 0 {
+		slot := time.Minute / time.Duration(m.MaxPerMinute)
+		if left := slot - time.Since(lastStart); left > wait {
+			wait = left
+		}
+	}
+	return wait
+}
+
+// MigrateWithJitter waits for a random duration in [0, maxJitter), drawn
+// from crypto/rand, before executing the migrations with MigrateContext, so
+// that many instances started at once, e.g. the pods of a deployment, don't
+// all contend for the advisory lock at the same moment
+func (m *Migrator) MigrateWithJitter(maxJitter time.Duration) error {
+	if maxJitter > 0 {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(maxJitter)))
+		if err != nil {
+			return err
+		}
+		time.Sleep(time.Duration(n.Int64()))
+	}
+	return m.MigrateContext(context.Background())
+}
@@ -0,0 +1,18 @@
+// Package pgmigratetest checks that migrations apply cleanly to an empty
+// database without a Postgres server at hand: Run starts a throwaway
+// embedded Postgres, migrates it and tears it down.
+//
+// The embedded server comes from github.com/fergusstrange/embedded-postgres,
+// which downloads Postgres binaries on first use. To keep it out of regular
+// builds it is only compiled with the embeddedpg build tag:
+//
+//	go get github.com/fergusstrange/embedded-postgres
+//	go test -tags embeddedpg ./...
+//
+// Without the tag Run returns ErrNotBuilt.
+package pgmigratetest
+
+import "errors"
+
+// ErrNotBuilt is returned by Run in builds without the embeddedpg tag
+var ErrNotBuilt = errors.New("pgmigratetest: built without the embeddedpg tag")
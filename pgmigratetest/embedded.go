@@ -0,0 +1,33 @@
+//go:build embeddedpg
+// +build embeddedpg
+
+package pgmigratetest
+
+import (
+	"context"
+	"fmt"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/netplugs/pgmigrate"
+)
+
+// Run starts an embedded Postgres listening on port, applies the migrations
+// of m to its empty database and stops it again, also when they fail. Only
+// the MigrationDir and migration settings of m are used: Conn and DB are
+// replaced by the embedded server.
+func Run(m *pgmigrate.Migrator, port uint32) ([]pgmigrate.Result, error) {
+	pg := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().
+		Port(port).
+		Database("pgmigrate"))
+	if err := pg.Start(); err != nil {
+		return nil, fmt.Errorf("pgmigratetest: start embedded postgres on port %d: %w", port, err)
+	}
+	defer pg.Stop()
+
+	local := *m
+	local.Conn = fmt.Sprintf("host=localhost port=%d user=postgres password=postgres dbname=pgmigrate sslmode=disable", port)
+	local.DB = nil
+	local.UseService = false
+	local.CacheTTL = 0
+	return local.MigrateResults(context.Background())
+}
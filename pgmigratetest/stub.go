@@ -0,0 +1,11 @@
+//go:build !embeddedpg
+// +build !embeddedpg
+
+package pgmigratetest
+
+import "github.com/netplugs/pgmigrate"
+
+// Run needs the embeddedpg build tag; without it, it returns ErrNotBuilt
+func Run(m *pgmigrate.Migrator, port uint32) ([]pgmigrate.Result, error) {
+	return nil, ErrNotBuilt
+}
@@ -0,0 +1,227 @@
+package pgmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// statusDirty is the status of a multi-phase migration interrupted after
+// some of its phases committed
+const statusDirty = "dirty"
+
+// phase is a part of a migration run either in a transaction or statement
+// by statement outside one
+type phase struct {
+	tx  bool
+	sql string
+}
+
+// phases splits the up part of a migration at its phase markers:
+//
+//	-- pgmigrate:phase tx
+//	ALTER TABLE orders ADD COLUMN customer_id bigint;
+//	-- pgmigrate:phase notx
+//	CREATE INDEX CONCURRENTLY orders_customer_id_idx ON orders (customer_id);
+//
+// SQL before the first marker forms a transactional phase. It returns nil
+// for migrations without markers.
+func phases(sql string) ([]phase, error) {
+	var (
+		list    []phase
+		current = phase{tx: true}
+		marked  bool
+		body    strings.Builder
+	)
+	flush := func() {
+		current.sql = body.String()
+		body.Reset()
+		// headers and comments before the first marker are not a phase
+		if len(list) == 0 && strings.TrimSpace(stripComments(current.sql)) == "" {
+			return
+		}
+		list = append(list, current)
+	}
+	for _, line := range strings.SplitAfter(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "--") {
+			directive := strings.TrimSpace(strings.TrimPrefix(trimmed, "--"))
+			if strings.HasPrefix(directive, headerPrefix) {
+				key, value := splitDirective(strings.TrimPrefix(directive, headerPrefix))
+				if key == "phase" {
+					switch strings.ToLower(value) {
+					case "tx", "notx":
+					default:
+						return nil, fmt.Errorf("unknown phase %q, want tx or notx", value)
+					}
+					flush()
+					current = phase{tx: strings.EqualFold(value, "tx")}
+					marked = true
+					continue
+				}
+			}
+		}
+		body.WriteString(line)
+	}
+	if !marked {
+		return nil, nil
+	}
+	flush()
+	return list, nil
+}
+
+// applyPhases runs the phases of a migration in order, committing each
+// before the next starts. Its tracking row is inserted first with the dirty
+// status and records the number of phases done, in the same transaction as
+// a transactional phase and right after a non-transactional one. A run
+// interrupted between phases leaves the migration dirty: the next run
+// resumes it after the last phase recorded, provided the file is unchanged
+// (it may change while no phase is recorded, e.g. to fix the first one).
+// A non-transactional phase cut short may have run part of its statements,
+// so they should be idempotent (IF NOT EXISTS). TrackingOrder does not apply.
+// BeforeMigration is called for each phase, with a nil transaction for
+// non-transactional ones.
+func (m *Migrator) applyPhases(ctx context.Context, db *sqlx.DB, id string, content []byte, header MigrationHeader, list []phase, runID string, track bool) (Result, error) {
+	var (
+		done  int
+		found bool // the dirty row of an earlier attempt exists
+	)
+	if track {
+		var row struct {
+			Checksum sql.NullString `db:"checksum"`
+			Phase    sql.NullInt64  `db:"phase"`
+		}
+		err := db.QueryRowxContext(ctx, "SELECT checksum, phase FROM "+m.Table+" WHERE id = $1 AND status = $2", id, statusDirty).StructScan(&row)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return Result{}, migrationError(StageRead, id, err)
+		case row.Phase.Int64 == 0:
+			// nothing committed yet: the file may have been fixed since
+			found = true
+		case row.Checksum.String != checksum(content):
+			return Result{}, migrationError(StageRead, id, fmt.Errorf("changed since it was partially applied (%d of %d phases)", row.Phase.Int64, len(list)))
+		default:
+			found = true
+			done = int(row.Phase.Int64)
+			m.logf("migration %s: resuming after phase %d of %d", id, done, len(list))
+		}
+	}
+	if done == 0 {
+		state, unmet, err := checkConditions(ctx, db, header)
+		if err != nil {
+			return Result{}, migrationError(StageExec, id, err)
+		}
+		if unmet {
+			return Result{ID: id, State: state}, nil
+		}
+		if track {
+			query := "INSERT INTO " + m.Table +
+				" (id, checksum, applied_at, applied_by, run_id, release_id, status, phase) VALUES ($1, $2, now(), current_user, $3, $4, $5, 0)"
+			if found {
+				query = "UPDATE " + m.Table +
+					" SET checksum = $2, applied_at = now(), applied_by = current_user, run_id = $3, release_id = $4 WHERE id = $1 AND status = $5"
+			}
+			_, err := db.ExecContext(ctx, query, id, checksum(content), runID, m.releaseID(), statusDirty)
+			if err != nil {
+				return Result{}, migrationError(StageTrack, id, err)
+			}
+		}
+	}
+
+	var (
+		start = time.Now()
+		rows  int64
+	)
+	for i := done; i < len(list); i++ {
+		var (
+			n   int64
+			err error
+		)
+		if list[i].tx {
+			n, err = m.applyTxPhase(ctx, db, id, header, list[i].sql, i+1, track)
+		} else {
+			n, err = m.applyNoTxPhase(ctx, db, id, header, list[i].sql, i+1, track)
+		}
+		if err != nil {
+			return Result{}, err
+		}
+		rows += n
+	}
+	if !track {
+		return Result{ID: id, State: StateRepeated, RowsAffected: rows}, nil
+	}
+	_, err := db.ExecContext(ctx, "UPDATE "+m.Table+" SET status = NULL, applied_at = now(), duration_ms = $2, run_id = $3 WHERE id = $1",
+		id, time.Since(start).Milliseconds(), runID)
+	if err != nil {
+		return Result{}, migrationError(StageTrack, id, err)
+	}
+	return Result{ID: id, State: StateApplied, RowsAffected: rows}, nil
+}
+
+// applyTxPhase runs phase n in a transaction that also records it as done
+func (m *Migrator) applyTxPhase(ctx context.Context, db *sqlx.DB, id string, header MigrationHeader, sql string, n int, track bool) (int64, error) {
+	txn, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, migrationError(StageExec, id, err)
+	}
+	m.setActiveTx(db, txn)
+	defer m.setActiveTx(db, nil)
+	if err := m.setLocalSession(ctx, txn); err != nil {
+		txn.Rollback()
+		return 0, migrationError(StageExec, id, err)
+	}
+	if _, err := setHeaderSettings(ctx, txn, header, true); err != nil {
+		txn.Rollback()
+		return 0, migrationError(StageExec, id, err)
+	}
+	if m.BeforeMigration != nil {
+		if err := m.BeforeMigration(ctx, txn, id); err != nil {
+			txn.Rollback()
+			return 0, migrationError(StageExec, id, err)
+		}
+	}
+	rows, err := m.execSQL(ctx, txn, sql, m.SplitStatements)
+	if err != nil {
+		txn.Rollback()
+		return 0, migrationError(StageExec, id, fmt.Errorf("phase %d: %w", n, err))
+	}
+	if track {
+		if _, err := txn.ExecContext(ctx, "UPDATE "+m.Table+" SET phase = $2 WHERE id = $1", id, n); err != nil {
+			txn.Rollback()
+			return 0, migrationError(StageTrack, id, err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return 0, migrationError(StageTrack, id, err)
+	}
+	return rows, nil
+}
+
+// applyNoTxPhase runs phase n statement by statement, then records it done
+func (m *Migrator) applyNoTxPhase(ctx context.Context, db *sqlx.DB, id string, header MigrationHeader, sql string, n int, track bool) (int64, error) {
+	restore, err := setHeaderSettings(ctx, db, header, false)
+	if err != nil {
+		return 0, migrationError(StageExec, id, err)
+	}
+	defer restore()
+	if m.BeforeMigration != nil {
+		if err := m.BeforeMigration(ctx, nil, id); err != nil {
+			return 0, migrationError(StageExec, id, err)
+		}
+	}
+	rows, err := m.execSQL(ctx, db, sql, true)
+	if err != nil {
+		return 0, migrationError(StageExec, id, fmt.Errorf("phase %d: %w", n, err))
+	}
+	if track {
+		if _, err := db.ExecContext(ctx, "UPDATE "+m.Table+" SET phase = $2 WHERE id = $1", id, n); err != nil {
+			return 0, migrationError(StageTrack, id, err)
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,82 @@
+package pgmigrate
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestPhases(t *testing.T) {
+	list, err := phases("-- pgmigrate: description: x\n-- pgmigrate:phase tx\nALTER TABLE t ADD c int;\n-- pgmigrate:phase notx\nCREATE INDEX CONCURRENTLY ON t (c);\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || !list[0].tx || list[1].tx {
+		t.Fatalf("phases = %+v, want a tx phase then a notx one", list)
+	}
+	if _, err := phases("-- pgmigrate:phase later\n"); err == nil {
+		t.Error("unknown phase kind accepted")
+	}
+}
+
+// phasedMigration fails its first phase until the flag table has a row
+const phasedMigration = `-- pgmigrate:phase tx
+CREATE TABLE phased (n int);
+INSERT INTO phased SELECT 1 / count(*) FROM flag;
+-- pgmigrate:phase notx
+CREATE INDEX CONCURRENTLY phased_n ON phased (n);
+`
+
+func TestPhasesRetryFirstPhase(t *testing.T) {
+	m := testMigrator(t, map[string]string{
+		"0001_flag.pgsql":   "CREATE TABLE flag (id int);\n",
+		"0002_phased.pgsql": phasedMigration,
+	})
+	ctx := context.Background()
+	if _, err := m.MigrateResults(ctx); err == nil {
+		t.Fatal("first phase succeeded without flag")
+	}
+	// the same file again, once what it waits for is there
+	db, err := m.connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("INSERT INTO flag VALUES (1)")
+	m.close(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.MigrateResults(ctx); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	var status string
+	testQuery(t, m, &status, "SELECT coalesce(status, 'applied') FROM migrations WHERE id = '0002_phased.pgsql'")
+	if status != "applied" {
+		t.Errorf("status %s after the retry", status)
+	}
+}
+
+func TestPhasesFixFirstPhase(t *testing.T) {
+	m := testMigrator(t, map[string]string{
+		"0001_flag.pgsql":   "CREATE TABLE flag (id int);\n",
+		"0002_phased.pgsql": phasedMigration,
+	})
+	ctx := context.Background()
+	if _, err := m.MigrateResults(ctx); err == nil {
+		t.Fatal("first phase succeeded without flag")
+	}
+	// editing the file is fine while no phase is recorded
+	fixed := "-- pgmigrate:phase tx\nCREATE TABLE phased (n int);\n-- pgmigrate:phase notx\nCREATE INDEX CONCURRENTLY phased_n ON phased (n);\n"
+	if err := ioutil.WriteFile(filepath.Join(m.MigrationDir, "0002_phased.pgsql"), []byte(fixed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.MigrateResults(ctx); err != nil {
+		t.Fatalf("run after the fix: %v", err)
+	}
+	var recorded string
+	testQuery(t, m, &recorded, "SELECT checksum FROM migrations WHERE id = '0002_phased.pgsql'")
+	if recorded != checksum([]byte(fixed)) {
+		t.Error("checksum of the fixed file not recorded")
+	}
+}
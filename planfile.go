@@ -0,0 +1,140 @@
+package pgmigrate
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// plannedMigration is a line of a plan file
+type plannedMigration struct {
+	ID       string
+	Checksum string
+}
+
+// SavePlan writes the migrations the next run would apply, as returned by
+// Plan, to path: one per line in the order they run, as the checksum and
+// the id separated by two spaces like sha256sum. Apply it later with
+// ApplyPlan, e.g. once it was reviewed.
+func (m *Migrator) SavePlan(ctx context.Context, path string) error {
+	plan, err := m.plannedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, p := range plan {
+		b.WriteString(p.Checksum + "  " + p.ID + "\n")
+	}
+	return writeFileAtomic(path, b.String())
+}
+
+// ApplyPlan applies exactly the migrations of the plan saved at path by
+// SavePlan; repeatable migrations don't run. The run fails without applying
+// anything when the plan is stale: once it holds the lock, the pending
+// migrations are no longer those of the plan, in the same order, or one of
+// their files changed since. Each migration is checked again against its
+// planned checksum right before it runs.
+func (m *Migrator) ApplyPlan(ctx context.Context, path string) error {
+	saved, err := readPlan(path)
+	if err != nil {
+		return err
+	}
+	if saved == nil {
+		saved = []plannedMigration{}
+	}
+	local := *m
+	local.plan = saved
+	local.noRepeatables = true
+	return local.MigrateContext(ctx)
+}
+
+// checkPlan fails when the selected pending migrations of files differ from
+// the plan being applied
+func (m *Migrator) checkPlan(files []string, selected map[string]bool) error {
+	var current []plannedMigration
+	for _, file := range files {
+		id := m.migrationID(file)
+		if !selected[id] {
+			continue
+		}
+		content, err := m.readMigration(file)
+		if err != nil {
+			return err
+		}
+		current = append(current, plannedMigration{ID: id, Checksum: checksum(content)})
+	}
+	var problems []string
+	for i := 0; i < len(m.plan) || i < len(current); i++ {
+		switch {
+		case i >= len(current):
+			problems = append(problems, "migration "+m.plan[i].ID+" is no longer pending")
+		case i >= len(m.plan):
+			problems = append(problems, "migration "+current[i].ID+" is pending but not planned")
+		case m.plan[i].ID != current[i].ID:
+			problems = append(problems, fmt.Sprintf("step %d is %s, planned %s", i+1, current[i].ID, m.plan[i].ID))
+		case m.plan[i].Checksum != current[i].Checksum:
+			problems = append(problems, ChecksumMismatch{ID: current[i].ID, Stored: m.plan[i].Checksum, Computed: current[i].Checksum}.String())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("plan is stale: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkPlanned fails when content, about to run as migration id, is not the
+// content planned for it
+func (m *Migrator) checkPlanned(id string, content []byte) error {
+	for _, p := range m.plan {
+		if p.ID != id {
+			continue
+		}
+		if sum := checksum(content); sum != p.Checksum {
+			return &ChecksumError{Mismatches: []ChecksumMismatch{{ID: id, Stored: p.Checksum, Computed: sum}}}
+		}
+		return nil
+	}
+	return fmt.Errorf("plan is stale: migration %s is pending but not planned", id)
+}
+
+// plannedMigrations returns Plan with the checksum of each migration
+func (m *Migrator) plannedMigrations(ctx context.Context) ([]plannedMigration, error) {
+	ids, err := m.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan := make([]plannedMigration, len(ids))
+	for i, id := range ids {
+		sum, err := m.Checksum(id)
+		if err != nil {
+			return nil, err
+		}
+		plan[i] = plannedMigration{ID: id, Checksum: sum}
+	}
+	return plan, nil
+}
+
+// readPlan parses a plan file written by SavePlan
+func readPlan(path string) ([]plannedMigration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var plan []plannedMigration
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s: malformed line %q", path, line)
+		}
+		plan = append(plan, plannedMigration{ID: fields[1], Checksum: fields[0]})
+	}
+	return plan, scanner.Err()
+}
@@ -0,0 +1,54 @@
+package pgmigrate
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyPlanSkipsRepeatables(t *testing.T) {
+	m := testMigrator(t, map[string]string{
+		"0001_orders.pgsql":            "CREATE TABLE orders (id int);\n",
+		repeatableDir + "/views.pgsql": "CREATE OR REPLACE VIEW order_ids AS SELECT id FROM orders;\n",
+	})
+	ctx := context.Background()
+	plan := filepath.Join(testDir(t, nil), "plan")
+	if err := m.SavePlan(ctx, plan); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ApplyPlan(ctx, plan); err != nil {
+		t.Fatal(err)
+	}
+	var orders, views int
+	testQuery(t, m, &orders, "SELECT count(*) FROM pg_tables WHERE schemaname = $1 AND tablename = 'orders'", m.Schema)
+	testQuery(t, m, &views, "SELECT count(*) FROM pg_views WHERE schemaname = $1", m.Schema)
+	if orders != 1 || views != 0 {
+		t.Errorf("%d planned tables and %d repeatable views created, want 1 and 0", orders, views)
+	}
+}
+
+func TestApplyPlanFailsWhenStale(t *testing.T) {
+	m := testMigrator(t, map[string]string{
+		"0001_orders.pgsql": "CREATE TABLE orders (id int);\n",
+	})
+	ctx := context.Background()
+	plan := filepath.Join(testDir(t, nil), "plan")
+	if err := m.SavePlan(ctx, plan); err != nil {
+		t.Fatal(err)
+	}
+	changed := "CREATE TABLE orders (id bigint);\n"
+	if err := ioutil.WriteFile(filepath.Join(m.MigrationDir, "0001_orders.pgsql"), []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := m.ApplyPlan(ctx, plan)
+	if err == nil || !strings.Contains(err.Error(), "plan is stale") {
+		t.Fatalf("ApplyPlan of a changed migration: %v, want a stale plan error", err)
+	}
+	var orders int
+	testQuery(t, m, &orders, "SELECT count(*) FROM pg_tables WHERE schemaname = $1 AND tablename = 'orders'", m.Schema)
+	if orders != 0 {
+		t.Error("stale plan applied")
+	}
+}
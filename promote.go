@@ -0,0 +1,98 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// PromoteFromStaging applies to the database of m the migrations applied on
+// the staging database at stagingConn but not here yet, in their usual
+// order, and nothing else: repeatable migrations don't run. Every one of
+// them must have its file in MigrationDir with the checksum recorded on
+// staging; otherwise nothing is applied. Migrations staging recorded
+// without a checksum are promoted without that check.
+func (m *Migrator) PromoteFromStaging(stagingConn string) error {
+	ctx := context.Background()
+	staging := *m
+	staging.Conn = stagingConn
+	staging.DB = nil
+	sdb, err := staging.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("staging: %w", err)
+	}
+	stagingRows, err := staging.tracked(ctx, sdb)
+	staging.close(sdb)
+	if err != nil {
+		return fmt.Errorf("staging: %w", err)
+	}
+
+	db, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	rows, err := m.tracked(ctx, db)
+	m.close(db)
+	if err != nil {
+		return err
+	}
+
+	files, err := m.migrationFiles()
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]string, len(files))
+	for _, file := range files {
+		byID[m.migrationID(file)] = file
+	}
+	promote := make(promoteStrategy)
+	var problems []string
+	for id, row := range stagingRows {
+		if row.Status.Valid {
+			// skipped or unfinished on staging
+			continue
+		}
+		if _, ok := rows[id]; ok {
+			continue
+		}
+		file, ok := byID[id]
+		if !ok {
+			problems = append(problems, "migration "+id+" is not in "+m.MigrationDir)
+			continue
+		}
+		if row.Checksum.Valid {
+			sum, ok, err := m.checksumMatches(row.Checksum.String, file)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				problems = append(problems, ChecksumMismatch{ID: id, Stored: row.Checksum.String, Computed: sum}.String())
+				continue
+			}
+		}
+		promote[id] = true
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("refusing to promote: %s", strings.Join(problems, "; "))
+	}
+	if len(promote) == 0 {
+		return nil
+	}
+	prod := *m
+	prod.Strategy = promote
+	prod.noRepeatables = true
+	return prod.MigrateContext(ctx)
+}
+
+// promoteStrategy selects the pending migrations in the set
+type promoteStrategy map[string]bool
+
+func (s promoteStrategy) PendingMigrations(applied []string, files []string) []string {
+	var pending []string
+	for _, id := range (ForwardStrategy{}).PendingMigrations(applied, files) {
+		if s[id] {
+			pending = append(pending, id)
+		}
+	}
+	return pending
+}
@@ -0,0 +1,96 @@
+package pgmigrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// isRemoteSource reports whether the migrations come from SourceURL
+func (m *Migrator) isRemoteSource() bool {
+	return strings.HasPrefix(m.SourceURL, "http://") || strings.HasPrefix(m.SourceURL, "https://")
+}
+
+// fetchSource downloads the archive at SourceURL, verifies it against
+// SourceSHA256 and extracts it into a temporary directory. The caller is
+// responsible for removing the returned directory.
+func (m *Migrator) fetchSource(ctx context.Context) (string, error) {
+	archive, err := ioutil.TempFile("", "pgmigrate-*.archive")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	for attempt := 0; ; attempt++ {
+		err = m.download(ctx, archive)
+		if err == nil || attempt >= m.SourceRetries || ctx.Err() != nil {
+			break
+		}
+		m.logf("download of %s failed (attempt %d): %v", m.SourceURL, attempt+1, err)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Duration(attempt+1) * time.Second):
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := ioutil.TempDir("", "pgmigrate-")
+	if err != nil {
+		return "", err
+	}
+	if err := extractArchive(archive.Name(), dir); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// download writes the body of SourceURL to f, replacing any previous
+// content, and checks its checksum
+func (m *Migrator) download(ctx context.Context, f *os.File) error {
+	req, err := http.NewRequest(http.MethodGet, m.SourceURL, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if m.SourceAuthHeader != "" {
+		req.Header.Set("Authorization", m.SourceAuthHeader)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download %s: unexpected status %s", m.SourceURL, resp.Status)
+	}
+
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), resp.Body); err != nil {
+		return err
+	}
+	if m.SourceSHA256 != "" {
+		sum := hex.EncodeToString(h.Sum(nil))
+		if !strings.EqualFold(sum, m.SourceSHA256) {
+			return fmt.Errorf("download %s: checksum mismatch: got %s, want %s", m.SourceURL, sum, m.SourceSHA256)
+		}
+	}
+	return nil
+}
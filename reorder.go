@@ -0,0 +1,137 @@
+package pgmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrAlreadyApplied is returned by ReorderMigrations for a migration that
+// is recorded in the migrations table: its id can't change anymore
+var ErrAlreadyApplied = errors.New("pgmigrate: migration already applied")
+
+// ReorderMigrations renames the unapplied migrations of MigrationDir so they
+// run in newOrder, e.g. after merging branches that each added migrations.
+// newOrder must list each of them exactly once. Their timestamps are
+// replaced with sequential ones starting now, one second apart, keeping the
+// rest of their names; down files and environment variants are renamed
+// along. Migrations recorded in the migrations table can't be reordered.
+func (m *Migrator) ReorderMigrations(newOrder []string) error {
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	tracked, err := m.tracked(ctx, db)
+	m.close(db)
+	if err != nil {
+		return err
+	}
+	files, err := m.directoryFiles()
+	if err != nil {
+		return err
+	}
+	unapplied := make(map[string]string)
+	for _, file := range files {
+		id := m.migrationID(file)
+		if _, ok := tracked[id]; !ok {
+			unapplied[id] = file
+		}
+	}
+	seen := make(map[string]bool, len(newOrder))
+	for _, id := range newOrder {
+		_, applied := tracked[id]
+		switch {
+		case seen[id]:
+			return fmt.Errorf("migration %s listed twice", id)
+		case applied:
+			return fmt.Errorf("migration %s: %w", id, ErrAlreadyApplied)
+		case unapplied[id] == "":
+			return fmt.Errorf("migration %s not found in %s", id, m.MigrationDir)
+		}
+		seen[id] = true
+	}
+	if len(seen) != len(unapplied) {
+		var missing []string
+		for id := range unapplied {
+			if !seen[id] {
+				missing = append(missing, id)
+			}
+		}
+		sort.Strings(missing)
+		return fmt.Errorf("new order misses %s", strings.Join(missing, ", "))
+	}
+
+	all, err := getFiles(m.MigrationDir)
+	if err != nil {
+		return err
+	}
+	renames := make(map[string]string)
+	start := time.Now().Truncate(time.Second)
+	for i, id := range newOrder {
+		file := unapplied[id]
+		oldStem, ok := m.timestampStem(filepath.Base(file))
+		if !ok {
+			return fmt.Errorf("migration %s doesn't start with a timestamp", id)
+		}
+		newStem := start.Add(time.Duration(i) * time.Second).Format(time.RFC3339Nano)
+		if m.MigrationIDPrefix != "" {
+			newStem = m.MigrationIDPrefix + "_" + newStem
+		}
+		for _, f := range all {
+			if m.fileMigrationID(f) == id {
+				renames[f] = filepath.Join(filepath.Dir(f), newStem+strings.TrimPrefix(filepath.Base(f), oldStem))
+			}
+		}
+	}
+	for _, to := range renames {
+		if _, err := os.Stat(to); err == nil && renames[to] == "" {
+			return fmt.Errorf("%s already exists", to)
+		}
+	}
+	// through temporary names, as a new name may be the old name of another
+	for from := range renames {
+		if err := os.Rename(from, from+".reorder"); err != nil {
+			return err
+		}
+	}
+	for from, to := range renames {
+		if err := os.Rename(from+".reorder", to); err != nil {
+			return err
+		}
+		fmt.Printf("renamed %s to %s\n", filepath.Base(from), filepath.Base(to))
+	}
+	return nil
+}
+
+// fileMigrationID returns the id of the migration file belongs to: its own,
+// that of its base variant or, for a down file, that of its up file
+func (m *Migrator) fileMigrationID(file string) string {
+	base, _ := m.splitVariant(file)
+	if m.MarkerStyle == MarkersGolangMigrate && strings.HasSuffix(base, ".down.sql") {
+		base = strings.TrimSuffix(base, ".down.sql") + ".up.sql"
+	}
+	return m.migrationID(base)
+}
+
+// timestampStem returns the leading "[<prefix>_]<timestamp>" of a migration
+// file name created by CreateMigration
+func (m *Migrator) timestampStem(base string) (string, bool) {
+	rest := base
+	if m.MigrationIDPrefix != "" {
+		rest = strings.TrimPrefix(base, m.MigrationIDPrefix+"_")
+	}
+	end := strings.IndexByte(rest, '_')
+	if end < 0 {
+		return "", false
+	}
+	if _, err := time.Parse(time.RFC3339Nano, rest[:end]); err != nil {
+		return "", false
+	}
+	return base[:len(base)-len(rest)+end], true
+}
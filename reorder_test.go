@@ -0,0 +1,40 @@
+package pgmigrate
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestReorderMigrationsSharingTimestamp(t *testing.T) {
+	m := testMigrator(t, map[string]string{
+		"2024-01-01T00:00:00Z_a.pgsql":      "CREATE TABLE a (id int);\n",
+		"2024-01-01T00:00:00Z_a.prod.pgsql": "CREATE TABLE a (id bigint);\n",
+		"2024-01-01T00:00:00Z_b.pgsql":      "CREATE TABLE b (id int);\n",
+	})
+	if err := m.ReorderMigrations([]string{"2024-01-01T00:00:00Z_b.pgsql", "2024-01-01T00:00:00Z_a.pgsql"}); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := ioutil.ReadDir(m.MigrationDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stems := make(map[string]string) // rest of the name -> timestamp stem
+	var names []string
+	for _, info := range infos {
+		stem, ok := m.timestampStem(info.Name())
+		if !ok {
+			t.Fatalf("%s has no timestamp", info.Name())
+		}
+		stems[strings.TrimPrefix(info.Name(), stem)] = stem
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	if len(names) != 3 {
+		t.Fatalf("files %q after reordering, want 3", names)
+	}
+	if stems["_b.pgsql"] >= stems["_a.pgsql"] || stems["_a.prod.pgsql"] != stems["_a.pgsql"] {
+		t.Errorf("files %q after reordering b before a", names)
+	}
+}
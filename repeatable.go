@@ -0,0 +1,50 @@
+package pgmigrate
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// repeatableDir is the subdirectory of MigrationDir holding repeatable
+// migrations; files named R__<name> anywhere are repeatable too
+const repeatableDir = "repeatable"
+
+// isRepeatable reports whether file is a repeatable migration: one that is
+// not tracked and runs again at the end of every run, e.g. to recreate views,
+// functions and grants. Its SQL must therefore be idempotent.
+func (m *Migrator) isRepeatable(file string) bool {
+	if strings.HasPrefix(filepath.Base(file), "R__") {
+		return true
+	}
+	rel := strings.TrimPrefix(m.migrationID(file), m.MigrationIDPrefix+"/")
+	return strings.HasPrefix(rel, repeatableDir+"/")
+}
+
+// RepeatableMigrations returns the ids of the repeatable migrations in the
+// order they run: after the versioned migrations, sorted by path
+func (m *Migrator) RepeatableMigrations() ([]string, error) {
+	files, err := m.repeatableFiles()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(files))
+	for i, file := range files {
+		ids[i] = m.migrationID(file)
+	}
+	return ids, nil
+}
+
+// repeatableFiles returns the repeatable migration files sorted by path
+func (m *Migrator) repeatableFiles() ([]string, error) {
+	files, err := getFiles(m.MigrationDir)
+	if err != nil {
+		return nil, err
+	}
+	var repeatables []string
+	for _, file := range files {
+		if m.isRepeatable(file) && !m.isDownFile(file) {
+			repeatables = append(repeatables, file)
+		}
+	}
+	return m.resolveVariants(repeatables), nil
+}
@@ -0,0 +1,56 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrExcessiveReplicationLag is returned when a replica lags behind the
+// primary by more than allowed
+type ErrExcessiveReplicationLag struct {
+	Replica  string // application_name of the replica, or its address
+	LagBytes int64  // WAL not replayed by the replica yet
+}
+
+func (e *ErrExcessiveReplicationLag) Error() string {
+	return fmt.Sprintf("replica %s lags by %d bytes of WAL", e.Replica, e.LagBytes)
+}
+
+// CheckReplicationLag returns an *ErrExcessiveReplicationLag for the most
+// lagging replica if it lags by more than maxLagBytes: the WAL written on
+// the primary that it has not replayed yet, which covers the write and
+// flush lag. Replicas are read from pg_stat_replication, so the check only
+// sees the replicas of the server connected to, and their positions only
+// with the pg_monitor role or as superuser; without, none lag.
+func (m *Migrator) CheckReplicationLag(maxLagBytes int64) error {
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.close(db)
+	return checkReplicationLag(ctx, db, maxLagBytes)
+}
+
+func checkReplicationLag(ctx context.Context, db *sqlx.DB, maxLagBytes int64) error {
+	var replicas []struct {
+		Name     string `db:"replica"`
+		LagBytes int64  `db:"lag_bytes"`
+	}
+	err := db.SelectContext(ctx, &replicas, `
+		SELECT coalesce(nullif(application_name, ''), client_addr::text, pid::text) AS replica,
+			pg_wal_lsn_diff(pg_current_wal_lsn(), replay_lsn)::bigint AS lag_bytes
+		FROM pg_stat_replication
+		WHERE replay_lsn IS NOT NULL
+		ORDER BY lag_bytes DESC
+		LIMIT 1`)
+	if err != nil {
+		return err
+	}
+	if len(replicas) > 0 && replicas[0].LagBytes > maxLagBytes {
+		return &ErrExcessiveReplicationLag{Replica: replicas[0].Name, LagBytes: replicas[0].LagBytes}
+	}
+	return nil
+}
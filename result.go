@@ -0,0 +1,126 @@
+package pgmigrate
+
+import (
+	"strings"
+
+	"github.com/jedib0t/go-pretty/table"
+)
+
+// State is the outcome of a migration in a run. Its String form is stable
+// and meant for machines; see Messages for the rendered labels.
+type State int
+
+// States reported in Result
+const (
+	StateAlreadyApplied    State = iota // applied by an earlier run
+	StateApplied                        // applied by this run
+	StatePreconditionUnmet              // skipped because its precondition is false
+	StateRepeated                       // repeatable migration run again by this run
+	StateSkipped                        // retired with Migrator.Skip
+	StateConditionFalse                 // skipped because its if condition is false
+)
+
+var stateNames = map[State]string{
+	StateAlreadyApplied:    "already_applied",
+	StateApplied:           "applied",
+	StatePreconditionUnmet: "precondition_unmet",
+	StateRepeated:          "repeated",
+	StateSkipped:           "skipped",
+	StateConditionFalse:    "condition_false",
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Result is the outcome of a single migration
+type Result struct {
+	ID    string
+	State State
+	// RowsAffected by the migration when applied by this run: the sum over
+	// its statements with SplitStatements, no-transaction or phases,
+	// otherwise that of its last statement as reported by Postgres
+	RowsAffected int64
+}
+
+// Messages holds the labels printed for each State in the migration table.
+// States missing from a Migrator's Messages fall back to DefaultMessages.
+type Messages map[State]string
+
+// DefaultMessages are the English labels used when Migrator.Messages is unset
+var DefaultMessages = Messages{
+	StateAlreadyApplied:    "already applied",
+	StateApplied:           "applied now",
+	StatePreconditionUnmet: "skipped (precondition)",
+	StateRepeated:          "applied again (repeatable)",
+	StateSkipped:           "skipped",
+	StateConditionFalse:    "skipped (condition)",
+}
+
+// label returns the message for s
+func (msgs Messages) label(s State) string {
+	if msg, ok := msgs[s]; ok {
+		return msg
+	}
+	if msg, ok := DefaultMessages[s]; ok {
+		return msg
+	}
+	return s.String()
+}
+
+// resultTable builds the table printed after a run
+func (m *Migrator) resultTable(results []Result) table.Writer {
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	display := m.displayIDs(ids)
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"migration", "status"})
+	for i, r := range results {
+		t.AppendRow(table.Row{display[i], m.Messages.label(r.State)})
+	}
+	return t
+}
+
+// displayIDs shortens ids longer than DisplayIDWidth characters for display:
+// the part up to the first underscore (the timestamp) is kept and the rest
+// is cut and ended with an ellipsis. Ids that would shorten to the same text
+// are shown in full, so the output stays unambiguous.
+func (m *Migrator) displayIDs(ids []string) []string {
+	display := make([]string, len(ids))
+	count := make(map[string]int, len(ids))
+	for i, id := range ids {
+		display[i] = shortenID(id, m.DisplayIDWidth)
+		count[display[i]]++
+	}
+	for i, id := range ids {
+		if count[display[i]] > 1 {
+			display[i] = id
+		}
+	}
+	return display
+}
+
+// shortenID cuts id to width characters, ellipsis included, without
+// cutting into the timestamp before its first underscore. width <= 0 leaves
+// it whole.
+func shortenID(id string, width int) string {
+	runes := []rune(id)
+	if width <= 0 || len(runes) <= width {
+		return id
+	}
+	if ts := strings.IndexRune(id, '_'); ts >= 0 {
+		// timestamp, underscore, one character of the name and the ellipsis
+		if min := len([]rune(id[:ts])) + 3; width < min {
+			width = min
+		}
+	}
+	if len(runes) <= width {
+		return id
+	}
+	return string(runes[:width-1]) + "…"
+}
@@ -0,0 +1,48 @@
+package pgmigrate
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MigrateWithRetry runs Migrate up to maxAttempts times, delay apart, as
+// long as it fails because the connection to the database was lost, e.g.
+// when a managed database restarts mid-run. Errors of the migrations
+// themselves, such as syntax errors, are returned immediately.
+func (m *Migrator) MigrateWithRetry(maxAttempts int, delay time.Duration) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = m.Migrate()
+		if err == nil || attempt >= maxAttempts || !isConnectionError(err) {
+			return err
+		}
+		m.logf("migration attempt %d of %d lost its connection: %v; retrying in %s", attempt, maxAttempts, err, delay)
+		time.Sleep(delay)
+	}
+}
+
+// isConnectionError reports whether err means the connection to the server
+// failed rather than a statement
+func isConnectionError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// class 08 is connection exception; 57P01-57P03 are server shutdown
+		// and startup
+		code := string(pqErr.Code)
+		return strings.HasPrefix(code, "08") || code == "57P01" || code == "57P02" || code == "57P03"
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ReversibilityError lists the migrations whose down part doesn't restore
+// the schema their up part started from
+type ReversibilityError struct {
+	Failures []ReversibilityFailure
+}
+
+// ReversibilityFailure explains why migration ID isn't cleanly reversible
+type ReversibilityFailure struct {
+	ID     string
+	Reason string
+}
+
+func (e *ReversibilityError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = f.ID + ": " + f.Reason
+	}
+	return "irreversible migrations: " + strings.Join(msgs, "; ")
+}
+
+// TestReversibility checks that every migration can be rolled back: for
+// each one in order it fingerprints the schema, applies the up part, applies
+// the down part and compares the fingerprint with the starting one, then
+// re-applies the up part so later migrations find what they depend on.
+// Migrations without a down part are reported as irreversible.
+//
+// It changes the schema and must run against a throwaway database: Conn
+// should point to an isolated database the caller provides. The migrations
+// table is not used.
+func (m *Migrator) TestReversibility(ctx context.Context) error {
+	db, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.close(db)
+	files, err := m.migrationFiles()
+	if err != nil {
+		return err
+	}
+	var failures []ReversibilityFailure
+	for _, file := range files {
+		id := m.migrationID(file)
+		content, err := m.readMigration(file)
+		if err != nil {
+			return err
+		}
+		up := m.upSQL(content)
+		down, err := m.downSQL(file, content)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(stripComments(down)) == "" {
+			failures = append(failures, ReversibilityFailure{ID: id, Reason: "no down migration"})
+			if err := execInTx(ctx, db, up); err != nil {
+				return fmt.Errorf("%s: up: %v", id, err)
+			}
+			continue
+		}
+		before, err := schemaFingerprint(ctx, db)
+		if err != nil {
+			return err
+		}
+		if err := execInTx(ctx, db, up); err != nil {
+			return fmt.Errorf("%s: up: %v", id, err)
+		}
+		if err := execInTx(ctx, db, down); err != nil {
+			return fmt.Errorf("%s: down: %v", id, err)
+		}
+		after, err := schemaFingerprint(ctx, db)
+		if err != nil {
+			return err
+		}
+		if after != before {
+			failures = append(failures, ReversibilityFailure{ID: id, Reason: "schema differs after down migration"})
+		}
+		if err := execInTx(ctx, db, up); err != nil {
+			return fmt.Errorf("%s: up after down: %v", id, err)
+		}
+	}
+	if len(failures) > 0 {
+		return &ReversibilityError{Failures: failures}
+	}
+	return nil
+}
+
+// execInTx executes query in its own transaction
+func execInTx(ctx context.Context, db *sqlx.DB, query string) error {
+	txn, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := txn.ExecContext(ctx, query); err != nil {
+		txn.Rollback()
+		return err
+	}
+	return txn.Commit()
+}
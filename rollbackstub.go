@@ -0,0 +1,63 @@
+package pgmigrate
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// rollbackStubMarker precedes each generated rollback statement
+const rollbackStubMarker = "-- AUTO-GENERATED STUB: review before use"
+
+// createTable matches a CREATE TABLE statement and its table name
+var createTable = regexp.MustCompile(`(?is)^CREATE\s+(?:UNLOGGED\s+|TEMP(?:ORARY)?\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?([\w."]+)`)
+
+// addColumn matches an ALTER TABLE ... ADD [COLUMN] statement, its table and
+// the first column it adds
+var addColumn = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?([\w."]+)\s+ADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?([\w"]+)`)
+
+// tableConstraints are the keywords following ADD that add a constraint, not
+// a column
+var tableConstraints = map[string]bool{
+	"CONSTRAINT": true, "PRIMARY": true, "UNIQUE": true, "CHECK": true, "FOREIGN": true, "EXCLUDE": true,
+}
+
+// CreateMigrationFromSQL creates a migration called name applying upSQL,
+// with a best-effort down part undoing it in reverse order: DROP TABLE IF
+// EXISTS ... CASCADE for each CREATE TABLE and DROP COLUMN IF EXISTS for
+// each ALTER TABLE ... ADD COLUMN. Other statements get no rollback. Each
+// generated statement is preceded by
+//
+//	-- AUTO-GENERATED STUB: review before use
+//
+// It requires a marker style keeping both parts in one file.
+func (m *Migrator) CreateMigrationFromSQL(name, upSQL string) error {
+	if m.MarkerStyle == MarkersGolangMigrate {
+		return errors.New("CreateMigrationFromSQL needs the up and down parts in one file, not MarkersGolangMigrate")
+	}
+	up, down := m.markers()
+	content := up + "\n" + strings.TrimSpace(upSQL) + "\n\n" + down + "\n"
+	for _, stmt := range rollbackStubs(upSQL) {
+		content += rollbackStubMarker + "\n" + stmt + "\n"
+	}
+	_, err := m.createMigration(name, content)
+	return err
+}
+
+// rollbackStubs returns the statements undoing the tables created and the
+// columns added by sql, last first
+func rollbackStubs(sql string) []string {
+	var stubs []string
+	stmts := splitStatements(sql)
+	for i := len(stmts) - 1; i >= 0; i-- {
+		stmt := stripComments(stmts[i])
+		if match := createTable.FindStringSubmatch(stmt); match != nil {
+			stubs = append(stubs, "DROP TABLE IF EXISTS "+match[1]+" CASCADE;")
+			continue
+		}
+		if match := addColumn.FindStringSubmatch(stmt); match != nil && !tableConstraints[strings.ToUpper(match[2])] {
+			stubs = append(stubs, "ALTER TABLE "+match[1]+" DROP COLUMN IF EXISTS "+match[2]+";")
+		}
+	}
+	return stubs
+}
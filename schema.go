@@ -0,0 +1,217 @@
+package pgmigrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// fingerprintQuery lists the user-visible schema as one line per column,
+// index and constraint. It is ordered with the C collation so the result
+// does not depend on the server's locale.
+const fingerprintQuery = `
+SELECT 'column ' || table_schema || '.' || table_name || '.' || column_name || ' ' ||
+	udt_name || ' ' || coalesce(character_maximum_length::text, '') || ' ' ||
+	coalesce(numeric_precision::text, '') || ' ' || coalesce(numeric_scale::text, '') || ' ' ||
+	is_nullable || ' ' || coalesce(column_default, '')
+FROM information_schema.columns
+WHERE table_schema NOT IN ('information_schema') AND table_schema NOT LIKE 'pg\_%'
+UNION ALL
+SELECT 'index ' || schemaname || '.' || indexname || ' ' || indexdef
+FROM pg_indexes
+WHERE schemaname NOT IN ('information_schema') AND schemaname NOT LIKE 'pg\_%'
+UNION ALL
+SELECT 'constraint ' || n.nspname || '.' || cl.relname || '.' || c.conname || ' ' || pg_get_constraintdef(c.oid)
+FROM pg_constraint c
+JOIN pg_namespace n ON n.oid = c.connamespace
+JOIN pg_class cl ON cl.oid = c.conrelid
+WHERE n.nspname NOT IN ('information_schema') AND n.nspname NOT LIKE 'pg\_%'
+ORDER BY 1 COLLATE "C"`
+
+// SchemaFingerprint returns a stable hash of the tables, columns, indexes and
+// constraints of the database. Two databases with the same fingerprint have
+// the same schema, which catches drift that migration tracking alone can't,
+// e.g. manual changes applied to only one environment.
+func (m *Migrator) SchemaFingerprint(ctx context.Context) (string, error) {
+	db, err := m.connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer m.close(db)
+	return schemaFingerprint(ctx, db)
+}
+
+func schemaFingerprint(ctx context.Context, db *sqlx.DB) (string, error) {
+	var lines []string
+	if err := db.SelectContext(ctx, &lines, fingerprintQuery); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, line := range lines {
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// recordFingerprint records the schema fingerprint with the migrations
+// applied by the run runID
+func (m *Migrator) recordFingerprint(ctx context.Context, db *sqlx.DB, runID string) error {
+	fingerprint, err := schemaFingerprint(ctx, db)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, "UPDATE "+m.Table+" SET fingerprint = $1 WHERE run_id = $2", fingerprint, runID)
+	return err
+}
+
+// RecordedFingerprint returns the schema fingerprint recorded by the latest
+// run with Fingerprint that applied migrations, or "" if there is none.
+// Compared with SchemaFingerprint, it tells whether the schema changed
+// outside migrations since.
+func (m *Migrator) RecordedFingerprint(ctx context.Context) (string, error) {
+	db, err := m.connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer m.close(db)
+	var fingerprint sql.NullString
+	err = db.QueryRowxContext(ctx, "SELECT fingerprint FROM "+m.Table+
+		" WHERE fingerprint IS NOT NULL ORDER BY applied_at DESC LIMIT 1").Scan(&fingerprint)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return fingerprint.String, err
+}
+
+// DumpSchema writes DDL recreating the sequences, tables, constraints and
+// indexes of the current schema to w. Statements are written in dependency
+// order: sequences, tables, then constraints with foreign keys last, then
+// the remaining indexes. It covers the same ground as
+// pg_dump --schema-only for plain tables but not views, functions or
+// triggers.
+func (m *Migrator) DumpSchema(w io.Writer) error {
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.close(db)
+
+	var sequences []struct {
+		Name      string `db:"sequence_name"`
+		Start     string `db:"start_value"`
+		Min       string `db:"minimum_value"`
+		Max       string `db:"maximum_value"`
+		Increment string `db:"increment"`
+		Cycle     string `db:"cycle_option"`
+	}
+	err = db.SelectContext(ctx, &sequences, `
+		SELECT sequence_name, start_value, minimum_value, maximum_value, increment, cycle_option
+		FROM information_schema.sequences
+		WHERE sequence_schema = current_schema()
+		ORDER BY sequence_name`)
+	if err != nil {
+		return err
+	}
+	for _, s := range sequences {
+		cycle := "NO CYCLE"
+		if s.Cycle == "YES" {
+			cycle = "CYCLE"
+		}
+		_, err := fmt.Fprintf(w, "CREATE SEQUENCE %s INCREMENT BY %s MINVALUE %s MAXVALUE %s START WITH %s %s;\n\n",
+			pq.QuoteIdentifier(s.Name), s.Increment, s.Min, s.Max, s.Start, cycle)
+		if err != nil {
+			return err
+		}
+	}
+
+	var columns []struct {
+		Table   string         `db:"table_name"`
+		Column  string         `db:"column_name"`
+		Type    string         `db:"column_type"`
+		NotNull bool           `db:"not_null"`
+		Default sql.NullString `db:"column_default"`
+	}
+	err = db.SelectContext(ctx, &columns, `
+		SELECT c.relname AS table_name, a.attname AS column_name,
+			format_type(a.atttypid, a.atttypmod) AS column_type, a.attnotnull AS not_null,
+			pg_get_expr(d.adbin, d.adrelid) AS column_default
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+		LEFT JOIN pg_attrdef d ON d.adrelid = c.oid AND d.adnum = a.attnum
+		WHERE n.nspname = current_schema() AND c.relkind IN ('r', 'p')
+		ORDER BY c.relname, a.attnum`)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(columns); {
+		table := columns[i].Table
+		var defs []string
+		for ; i < len(columns) && columns[i].Table == table; i++ {
+			c := columns[i]
+			def := "    " + pq.QuoteIdentifier(c.Column) + " " + c.Type
+			if c.Default.Valid {
+				def += " DEFAULT " + c.Default.String
+			}
+			if c.NotNull {
+				def += " NOT NULL"
+			}
+			defs = append(defs, def)
+		}
+		_, err := fmt.Fprintf(w, "CREATE TABLE %s (\n%s\n);\n\n", pq.QuoteIdentifier(table), strings.Join(defs, ",\n"))
+		if err != nil {
+			return err
+		}
+	}
+
+	var constraints []struct {
+		Table      string `db:"table_name"`
+		Name       string `db:"constraint_name"`
+		Definition string `db:"definition"`
+	}
+	err = db.SelectContext(ctx, &constraints, `
+		SELECT cl.relname AS table_name, c.conname AS constraint_name, pg_get_constraintdef(c.oid) AS definition
+		FROM pg_constraint c
+		JOIN pg_class cl ON cl.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		WHERE n.nspname = current_schema() AND c.contype <> 'n'
+		ORDER BY c.contype = 'f', cl.relname, c.conname`)
+	if err != nil {
+		return err
+	}
+	for _, c := range constraints {
+		_, err := fmt.Fprintf(w, "ALTER TABLE %s ADD CONSTRAINT %s %s;\n\n",
+			pq.QuoteIdentifier(c.Table), pq.QuoteIdentifier(c.Name), c.Definition)
+		if err != nil {
+			return err
+		}
+	}
+
+	var indexes []string
+	err = db.SelectContext(ctx, &indexes, `
+		SELECT pg_get_indexdef(i.indexrelid)
+		FROM pg_index i
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		JOIN pg_namespace n ON n.oid = ic.relnamespace
+		WHERE n.nspname = current_schema()
+			AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = i.indexrelid AND c.contype IN ('p', 'u', 'x'))
+		ORDER BY ic.relname`)
+	if err != nil {
+		return err
+	}
+	for _, def := range indexes {
+		if _, err := fmt.Fprintf(w, "%s;\n\n", def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
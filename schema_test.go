@@ -0,0 +1,41 @@
+package pgmigrate
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	m := testMigrator(t, map[string]string{
+		"0001_orders.pgsql": "CREATE TABLE orders (id int PRIMARY KEY);\n",
+	})
+	m.Fingerprint = true
+	ctx := context.Background()
+	if _, err := m.MigrateResults(ctx); err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := m.RecordedFingerprint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := m.SchemaFingerprint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded == "" || recorded != current {
+		t.Errorf("recorded fingerprint %q, want the current %q", recorded, current)
+	}
+
+	// a run applying a migration records the new schema
+	if err := ioutil.WriteFile(filepath.Join(m.MigrationDir, "0002_items.pgsql"), []byte("CREATE TABLE items (id int);\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.MigrateResults(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if next, err := m.RecordedFingerprint(ctx); err != nil || next == recorded {
+		t.Errorf("fingerprint after a second migration = %q, %v, want a new one", next, err)
+	}
+}
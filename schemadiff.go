@@ -0,0 +1,180 @@
+package pgmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ErrNoSchemaChanges is returned by GenerateDiff when the schemas compared
+// don't differ in what it supports
+var ErrNoSchemaChanges = errors.New("pgmigrate: no schema changes to generate a migration for")
+
+// diffColumn is a column of a table of the current schema, as GenerateDiff
+// compares it
+type diffColumn struct {
+	Table   string  `db:"table_name"`
+	Name    string  `db:"column_name"`
+	Type    string  `db:"column_type"`
+	NotNull bool    `db:"not_null"`
+	Default *string `db:"column_default"`
+}
+
+// definition returns the column definition of c in CREATE TABLE and ADD
+// COLUMN
+func (c diffColumn) definition() string {
+	def := pq.QuoteIdentifier(c.Name) + " " + c.Type
+	if c.Default != nil {
+		def += " DEFAULT " + *c.Default
+	}
+	if c.NotNull {
+		def += " NOT NULL"
+	}
+	return def
+}
+
+// GenerateDiff creates a migration called name, through the usual create
+// path, with the DDL turning the current schema of the database at the
+// connection string from into that of the database at to, e.g. a
+// development database where the change was designed; the down part, unless
+// MarkerStyle keeps it in another file, turns it back.
+//
+// Only tables and their columns are compared: tables created and dropped,
+// columns added and dropped, and changes of column type (converted with a
+// USING cast), NOT NULL and default. Indexes, constraints, identity and
+// generated columns, sequences, views, functions and every other object are
+// not, nor renames, which appear as a drop and an add. Review the result
+// before applying it: dropping loses data, and a type conversion may need a
+// better USING expression. It returns ErrNoSchemaChanges if there is
+// nothing to generate.
+func (m *Migrator) GenerateDiff(ctx context.Context, from, to string, name string) error {
+	fromColumns, err := m.diffColumns(ctx, from)
+	if err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+	toColumns, err := m.diffColumns(ctx, to)
+	if err != nil {
+		return fmt.Errorf("to: %w", err)
+	}
+	up := schemaDiff(fromColumns, toColumns)
+	if len(up) == 0 {
+		return ErrNoSchemaChanges
+	}
+	content := strings.Join(up, "\n") + "\n"
+	if m.MarkerStyle != MarkersGolangMigrate {
+		upMarker, downMarker := m.markers()
+		content = upMarker + "\n" + content + "\n" + downMarker + "\n" + strings.Join(schemaDiff(toColumns, fromColumns), "\n") + "\n"
+	}
+	_, err = m.createMigration(name, content)
+	return err
+}
+
+// diffColumns returns the columns of the tables of the current schema of
+// the database at conn, by table then position
+func (m *Migrator) diffColumns(ctx context.Context, conn string) ([]diffColumn, error) {
+	local := *m
+	local.Conn = conn
+	local.DB = nil
+	db, err := local.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer local.close(db)
+	var columns []diffColumn
+	err = db.SelectContext(ctx, &columns, `
+		SELECT cl.relname AS table_name, a.attname AS column_name,
+			format_type(a.atttypid, a.atttypmod) AS column_type, a.attnotnull AS not_null,
+			pg_get_expr(d.adbin, d.adrelid) AS column_default
+		FROM pg_attribute a
+		JOIN pg_class cl ON cl.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE n.nspname = current_schema() AND cl.relkind IN ('r', 'p')
+			AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY cl.relname COLLATE "C", a.attnum`)
+	return columns, err
+}
+
+// schemaDiff returns the statements turning the tables with columns from
+// into those with columns to: the tables dropped first, then the other
+// tables in name order, each created or altered column by column
+func schemaDiff(from, to []diffColumn) []string {
+	fromTables, fromNames := columnsByTable(from)
+	toTables, toNames := columnsByTable(to)
+	var stmts []string
+	for _, table := range fromNames {
+		if _, ok := toTables[table]; !ok {
+			stmts = append(stmts, "DROP TABLE "+pq.QuoteIdentifier(table)+";")
+		}
+	}
+	for _, table := range toNames {
+		columns := toTables[table]
+		quoted := pq.QuoteIdentifier(table)
+		old, ok := fromTables[table]
+		if !ok {
+			defs := make([]string, len(columns))
+			for i, c := range columns {
+				defs[i] = "    " + c.definition()
+			}
+			stmts = append(stmts, "CREATE TABLE "+quoted+" (\n"+strings.Join(defs, ",\n")+"\n);")
+			continue
+		}
+		oldByName := make(map[string]diffColumn, len(old))
+		for _, c := range old {
+			oldByName[c.Name] = c
+		}
+		newByName := make(map[string]bool, len(columns))
+		for _, c := range columns {
+			newByName[c.Name] = true
+		}
+		for _, c := range old {
+			if !newByName[c.Name] {
+				stmts = append(stmts, "ALTER TABLE "+quoted+" DROP COLUMN "+pq.QuoteIdentifier(c.Name)+";")
+			}
+		}
+		for _, c := range columns {
+			prev, ok := oldByName[c.Name]
+			if !ok {
+				stmts = append(stmts, "ALTER TABLE "+quoted+" ADD COLUMN "+c.definition()+";")
+				continue
+			}
+			alter := "ALTER TABLE " + quoted + " ALTER COLUMN " + pq.QuoteIdentifier(c.Name)
+			if c.Type != prev.Type {
+				stmts = append(stmts, alter+" TYPE "+c.Type+" USING "+pq.QuoteIdentifier(c.Name)+"::"+c.Type+";")
+			}
+			switch {
+			case c.Default == nil && prev.Default != nil:
+				stmts = append(stmts, alter+" DROP DEFAULT;")
+			case c.Default != nil && (prev.Default == nil || *c.Default != *prev.Default):
+				stmts = append(stmts, alter+" SET DEFAULT "+*c.Default+";")
+			}
+			if c.NotNull != prev.NotNull {
+				if c.NotNull {
+					stmts = append(stmts, alter+" SET NOT NULL;")
+				} else {
+					stmts = append(stmts, alter+" DROP NOT NULL;")
+				}
+			}
+		}
+	}
+	return stmts
+}
+
+// columnsByTable groups columns by table, keeping their order, and returns
+// the table names sorted
+func columnsByTable(columns []diffColumn) (map[string][]diffColumn, []string) {
+	tables := make(map[string][]diffColumn)
+	var names []string
+	for _, c := range columns {
+		if _, ok := tables[c.Table]; !ok {
+			names = append(names, c.Table)
+		}
+		tables[c.Table] = append(tables[c.Table], c)
+	}
+	sort.Strings(names)
+	return tables, names
+}
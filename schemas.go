@@ -0,0 +1,114 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SchemaError lists the schemas that failed to migrate with their error
+type SchemaError struct {
+	Errors map[string]error
+}
+
+func (e *SchemaError) Error() string {
+	schemas := make([]string, 0, len(e.Errors))
+	for schema := range e.Errors {
+		schemas = append(schemas, schema)
+	}
+	sort.Strings(schemas)
+	msgs := make([]string, len(schemas))
+	for i, schema := range schemas {
+		msgs[i] = "schema " + schema + ": " + e.Errors[schema].Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// MigrateSchema executes the migrations against schema: it is used as the
+// search_path of the connection, so the migrations table and unqualified
+// objects live in that schema
+func (m *Migrator) MigrateSchema(schema string) error {
+	s := *m
+	s.Schema = schema
+	return s.MigrateContext(context.Background())
+}
+
+// MigrateIfSchema is like MigrateSchema but logs and returns nil without
+// migrating when schema doesn't exist in the database, e.g. one only
+// created for some tiers
+func (m *Migrator) MigrateIfSchema(schema string) error {
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		return migrationError(StageConnect, "", err)
+	}
+	var exists bool
+	err = db.QueryRowxContext(ctx,
+		"SELECT EXISTS (SELECT schema_name FROM information_schema.schemata WHERE schema_name = $1)", schema).Scan(&exists)
+	m.close(db)
+	if err != nil {
+		return migrationError(StageConnect, "", err)
+	}
+	if !exists {
+		m.logf("schema %s does not exist, skipping its migrations", schema)
+		return nil
+	}
+	return m.MigrateSchema(schema)
+}
+
+// MigrateParallelSchemas migrates each of schemas with MigrateSchema using
+// a pool of workers, each with its own connection. All schemas are
+// attempted; the failed ones are returned in a *SchemaError. Schemas that
+// succeeded stay migrated.
+func (m *Migrator) MigrateParallelSchemas(schemas []string, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		mu    sync.Mutex
+		errs  = make(map[string]error)
+		wg    sync.WaitGroup
+		queue = make(chan string)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for schema := range queue {
+				if err := m.MigrateSchema(schema); err != nil {
+					mu.Lock()
+					errs[schema] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, schema := range schemas {
+		queue <- schema
+	}
+	close(queue)
+	wg.Wait()
+	if len(errs) > 0 {
+		return &SchemaError{Errors: errs}
+	}
+	return nil
+}
+
+// MigrateShard migrates the schemas of Tenants that belong to shard shardID
+// of totalShards, those whose index i in Tenants has i % totalShards ==
+// shardID, with MigrateParallelSchemas on MaxParallel connections. Each of
+// totalShards processes, e.g. pods, can then migrate its own shard.
+func (m *Migrator) MigrateShard(shardID int, totalShards int) error {
+	if totalShards < 1 || shardID < 0 || shardID >= totalShards {
+		return fmt.Errorf("shard %d of %d doesn't exist", shardID, totalShards)
+	}
+	var schemas []string
+	for i, tenant := range m.Tenants {
+		if i%totalShards == shardID {
+			schemas = append(schemas, tenant)
+		}
+	}
+	return m.MigrateParallelSchemas(schemas, m.MaxParallel)
+}
@@ -0,0 +1,128 @@
+package pgmigrate
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// setSearchPath matches a session-level SET search_path statement
+var setSearchPath = regexp.MustCompile(`(?is)^SET\s+(SESSION\s+)?search_path\b`)
+
+// searchPathStatement returns the SET search_path statement opening the up
+// part of the migration in file, or ""
+func (m *Migrator) searchPathStatement(file string) (string, error) {
+	content, err := m.readMigration(file)
+	if err != nil {
+		return "", err
+	}
+	stmts := splitStatements(m.upSQL(content))
+	if len(stmts) == 0 {
+		return "", nil
+	}
+	if stmt := stripComments(stmts[0]); setSearchPath.MatchString(stmt) {
+		return stmt, nil
+	}
+	return "", nil
+}
+
+// sessionPath is the search_path state of the session of a run, so that
+// the search_path is only set, and the migrations table of a path only
+// created, when needed
+type sessionPath struct {
+	initial string                      // search_path the session started with
+	tracked map[string]trackedMigration // rows of the migrations table of initial when the run started
+	current string                      // SET search_path statement in effect, "" for initial
+	known   bool                        // current is in effect: false once the session may have changed
+	tables  map[string]bool             // statements whose migrations table exists
+}
+
+// newSessionPath returns the state of the session of db, whose search_path
+// is initial and has its migrations table
+func newSessionPath(ctx context.Context, db *sqlx.DB) (*sessionPath, error) {
+	initial, err := searchPath(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionPath{initial: initial, known: true, tables: map[string]bool{"": true}}, nil
+}
+
+// applied returns the result of the migration id when the migrations table
+// of the initial search_path recorded it as applied or skipped at the start
+// of the run. It holds migrations starting with SET search_path applied
+// before their tracking row followed that path, so they are not applied
+// again there.
+func (p *sessionPath) applied(id string) (Result, bool) {
+	row, ok := p.tracked[id]
+	switch {
+	case !ok || row.Status.String == statusDirty:
+		return Result{}, false
+	case row.Status.String == statusSkipped:
+		return Result{ID: id, State: StateSkipped}, true
+	}
+	return Result{ID: id, State: StateAlreadyApplied}, true
+}
+
+// forget records that the search_path of the session may have changed,
+// e.g. by a migration or a reset
+func (p *sessionPath) forget() {
+	p.known = false
+}
+
+// useSearchPath sets the search_path of the session for the migration in
+// file, unless already in effect. A migration starting with SET search_path
+// has it applied to the whole session before anything else, so its
+// tracking row is looked up and recorded in the migrations table of that
+// path, created the first time the path is used, and not only its SQL runs
+// there. Other migrations get the initial search_path of path. Call it only
+// for migrations path.applied doesn't know.
+func (m *Migrator) useSearchPath(ctx context.Context, db *sqlx.DB, file string, path *sessionPath) error {
+	if m.PoolerSafe {
+		// the session may change with each transaction
+		return nil
+	}
+	stmt, err := m.searchPathStatement(file)
+	if err != nil {
+		return err
+	}
+	if path.known && stmt == path.current {
+		return nil
+	}
+	path.known = false
+	if stmt == "" {
+		_, err := db.ExecContext(ctx, "SELECT set_config('search_path', $1, false)", path.initial)
+		if err == nil {
+			path.current, path.known = stmt, true
+		}
+		return err
+	}
+	if _, err := db.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	path.current, path.known = stmt, true
+	if path.tables[stmt] {
+		return nil
+	}
+	if m.Schema != "" {
+		var current string
+		if err := db.QueryRowxContext(ctx, "SELECT coalesce(current_schema(), '')").Scan(&current); err != nil {
+			return err
+		}
+		if current != m.Schema {
+			m.logf("warning: migration %s sets search_path to schema %q instead of Schema %q", m.migrationID(file), current, m.Schema)
+		}
+	}
+	if err := createMigrationsTableIfNotExists(db, m.Table); err != nil {
+		return err
+	}
+	path.tables[stmt] = true
+	return nil
+}
+
+// searchPath returns the current search_path of the session
+func searchPath(ctx context.Context, db *sqlx.DB) (string, error) {
+	var path string
+	err := db.QueryRowxContext(ctx, "SELECT current_setting('search_path')").Scan(&path)
+	return path, err
+}
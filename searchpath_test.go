@@ -0,0 +1,109 @@
+package pgmigrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestSessionPathApplied(t *testing.T) {
+	p := &sessionPath{tracked: map[string]trackedMigration{
+		"applied": {ID: "applied"},
+		"skipped": {ID: "skipped", Status: sql.NullString{String: statusSkipped, Valid: true}},
+		"dirty":   {ID: "dirty", Status: sql.NullString{String: statusDirty, Valid: true}},
+	}}
+	tests := []struct {
+		id    string
+		state State
+		ok    bool
+	}{
+		{"applied", StateAlreadyApplied, true},
+		{"skipped", StateSkipped, true},
+		{"dirty", 0, false},
+		{"pending", 0, false},
+	}
+	for _, tt := range tests {
+		result, ok := p.applied(tt.id)
+		if ok != tt.ok || ok && (result.ID != tt.id || result.State != tt.state) {
+			t.Errorf("applied(%s) = %+v, %v", tt.id, result, ok)
+		}
+	}
+}
+
+// searchPathMigrator returns a test Migrator whose first migration sets the
+// search_path to another schema, created for the test
+func searchPathMigrator(t *testing.T) (*Migrator, string) {
+	m := testMigrator(t, nil)
+	other := m.Schema + "_other"
+	m.MigrationDir = testDir(t, map[string]string{
+		"0001_other.pgsql": "SET search_path TO " + other + ";\nCREATE TABLE widgets (id int);\n",
+		"0002_own.pgsql":   "CREATE TABLE orders (id int);\n",
+	})
+	db, err := m.connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.close(db)
+	if _, err := db.Exec("CREATE SCHEMA " + other); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if db, err := m.connect(context.Background()); err == nil {
+			db.Exec("DROP SCHEMA " + other + " CASCADE")
+			m.close(db)
+		}
+	})
+	return m, other
+}
+
+func TestSearchPathMigrations(t *testing.T) {
+	m, other := searchPathMigrator(t)
+	ctx := context.Background()
+	if _, err := m.MigrateResults(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var inOther, inOwn int
+	testQuery(t, m, &inOther, "SELECT count(*) FROM "+other+".migrations WHERE id = '0001_other.pgsql'")
+	testQuery(t, m, &inOwn, "SELECT count(*) FROM migrations WHERE id = '0002_own.pgsql'")
+	if inOther != 1 || inOwn != 1 {
+		t.Fatalf("tracking rows in the other and own schemas: %d, %d, want 1, 1", inOther, inOwn)
+	}
+	results, err := m.MigrateResults(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.State != StateAlreadyApplied {
+			t.Errorf("second run: %s %s", r.ID, r.State)
+		}
+	}
+}
+
+func TestSearchPathMigrationTrackedBefore(t *testing.T) {
+	// applied when tracking rows didn't follow SET search_path yet
+	m, other := searchPathMigrator(t)
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := createMigrationsTableIfNotExists(db, m.Table); err == nil {
+		_, err = db.Exec("INSERT INTO " + m.Table + " (id) VALUES ('0001_other.pgsql')")
+	}
+	m.close(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := m.MigrateResults(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].State != StateAlreadyApplied || results[1].State != StateApplied {
+		t.Errorf("results %+v, want 0001 already applied and 0002 applied", results)
+	}
+	var widgets int
+	testQuery(t, m, &widgets, "SELECT count(*) FROM pg_tables WHERE schemaname = $1 AND tablename = 'widgets'", other)
+	if widgets != 0 {
+		t.Error("0001_other.pgsql applied again")
+	}
+}
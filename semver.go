@@ -0,0 +1,134 @@
+package pgmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// versionPrefix matches the vMAJOR.MINOR prefix of migration file names
+// under UseSemanticVersioning, e.g. v2.3_add_column.pgsql
+var versionPrefix = regexp.MustCompile(`^v(\d+)\.(\d+)(?:[^0-9]|$)`)
+
+// Version is the MAJOR.MINOR version of a migration named vMAJOR.MINOR_...
+type Version struct {
+	Major int
+	Minor int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("v%d.%d", v.Major, v.Minor)
+}
+
+// Less reports whether v sorts before w
+func (v Version) Less(w Version) bool {
+	if v.Major != w.Major {
+		return v.Major < w.Major
+	}
+	return v.Minor < w.Minor
+}
+
+// ErrNoVersion is returned by SchemaVersion when no versioned migration is
+// applied
+var ErrNoVersion = errors.New("pgmigrate: no versioned migration applied")
+
+// migrationVersion parses the version of the migration file or id, whose
+// base name may start with MigrationIDPrefix and an underscore
+func (m *Migrator) migrationVersion(file string) (Version, bool) {
+	base := path.Base(strings.Replace(file, `\`, "/", -1))
+	if m.MigrationIDPrefix != "" {
+		base = strings.TrimPrefix(base, m.MigrationIDPrefix+"_")
+	}
+	match := versionPrefix.FindStringSubmatch(base)
+	if match == nil {
+		return Version{}, false
+	}
+	major, err1 := strconv.Atoi(match[1])
+	minor, err2 := strconv.Atoi(match[2])
+	if err1 != nil || err2 != nil {
+		return Version{}, false
+	}
+	return Version{Major: major, Minor: minor}, true
+}
+
+// sortByVersion orders files by version, keeping path order among those of
+// the same version. Every file must have a version.
+func (m *Migrator) sortByVersion(files []string) error {
+	versions := make(map[string]Version, len(files))
+	for _, file := range files {
+		v, ok := m.migrationVersion(file)
+		if !ok {
+			return fmt.Errorf("migration %s has no vMAJOR.MINOR prefix", m.migrationID(file))
+		}
+		versions[file] = v
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return versions[files[i]].Less(versions[files[j]])
+	})
+	return nil
+}
+
+// MigrateToVersion applies the pending migrations up to and including
+// version major.minor, in version order. It requires UseSemanticVersioning.
+func (m *Migrator) MigrateToVersion(major, minor int) error {
+	if !m.UseSemanticVersioning {
+		return errors.New("MigrateToVersion requires UseSemanticVersioning")
+	}
+	local := *m
+	local.Strategy = versionStrategy{m: m, target: Version{Major: major, Minor: minor}}
+	return local.MigrateContext(context.Background())
+}
+
+// versionStrategy selects the pending migrations up to target
+type versionStrategy struct {
+	m      *Migrator
+	target Version
+}
+
+func (s versionStrategy) PendingMigrations(applied []string, files []string) []string {
+	var pending []string
+	for _, id := range (ForwardStrategy{}).PendingMigrations(applied, files) {
+		if v, ok := s.m.migrationVersion(id); ok && !s.target.Less(v) {
+			pending = append(pending, id)
+		}
+	}
+	return pending
+}
+
+// SchemaVersion returns the highest version among the applied migrations,
+// or ErrNoVersion. It requires UseSemanticVersioning.
+func (m *Migrator) SchemaVersion(ctx context.Context) (Version, error) {
+	if !m.UseSemanticVersioning {
+		return Version{}, errors.New("SchemaVersion requires UseSemanticVersioning")
+	}
+	db, err := m.connect(ctx)
+	if err != nil {
+		return Version{}, err
+	}
+	defer m.close(db)
+	tracked, err := m.tracked(ctx, db)
+	if err != nil {
+		return Version{}, err
+	}
+	var (
+		version Version
+		found   bool
+	)
+	for id, row := range tracked {
+		if row.Status.Valid {
+			continue
+		}
+		if v, ok := m.migrationVersion(id); ok && (!found || version.Less(v)) {
+			version, found = v, true
+		}
+	}
+	if !found {
+		return Version{}, ErrNoVersion
+	}
+	return version, nil
+}
@@ -0,0 +1,100 @@
+package pgmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SetSessionVariable adds the run-time parameter key with value to
+// SessionVars. Like SET SESSION it lasts for the whole session, so it
+// applies to every migration of a run.
+func (m *Migrator) SetSessionVariable(key, value string) error {
+	if key == "" {
+		return errors.New("session variable name is empty")
+	}
+	if m.SessionVars == nil {
+		m.SessionVars = make(map[string]string)
+	}
+	m.SessionVars[key] = value
+	return nil
+}
+
+// setSessionVars sets SessionVars on db in key order. SET takes no bind
+// parameters, so set_config is used to keep names and values out of the SQL.
+func (m *Migrator) setSessionVars(ctx context.Context, db *sqlx.DB) error {
+	keys := make([]string, 0, len(m.SessionVars))
+	for k := range m.SessionVars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, err := db.ExecContext(ctx, "SELECT set_config($1, $2, false)", k, m.SessionVars[k]); err != nil {
+			return fmt.Errorf("set %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// resetSession returns the session of db to its state after connect, for
+// IsolateSessions: the statements DISCARD ALL is equivalent to, except for
+// releasing advisory locks as that would release the lock of the run, then
+// SessionVars and AfterConnect again.
+func (m *Migrator) resetSession(ctx context.Context, db *sqlx.DB) error {
+	for _, stmt := range []string{
+		"CLOSE ALL",
+		"SET SESSION AUTHORIZATION DEFAULT",
+		"RESET ALL",
+		"DEALLOCATE ALL",
+		"UNLISTEN *",
+		"DISCARD PLANS",
+		"DISCARD TEMP",
+		"DISCARD SEQUENCES",
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("reset session: %w", err)
+		}
+	}
+	if err := m.setSessionVars(ctx, db); err != nil {
+		return err
+	}
+	if m.AfterConnect != nil {
+		return m.AfterConnect(ctx, db)
+	}
+	return nil
+}
+
+// setLocalSession sets SessionVars for the rest of the transaction open on
+// e with PoolerSafe, where they can't be set on the session
+func (m *Migrator) setLocalSession(ctx context.Context, e sqlx.ExecerContext) error {
+	if !m.PoolerSafe {
+		return nil
+	}
+	keys := make([]string, 0, len(m.SessionVars))
+	for k := range m.SessionVars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, err := e.ExecContext(ctx, "SELECT set_config($1, $2, true)", k, m.SessionVars[k]); err != nil {
+			return fmt.Errorf("set %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// isolate resets the session before the migration in file: see
+// IsolateSessions
+func (m *Migrator) isolate(ctx context.Context, db *sqlx.DB, file string, path *sessionPath) error {
+	if m.PoolerSafe {
+		return nil
+	}
+	path.forget()
+	if err := m.resetSession(ctx, db); err != nil {
+		return err
+	}
+	return m.useSearchPath(ctx, db, file, path)
+}
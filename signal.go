@@ -0,0 +1,107 @@
+package pgmigrate
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// activeRuns tracks the runs in flight for a Migrator so RollbackOnSignal
+// can abort them. Copies of a Migrator share it.
+type activeRuns struct {
+	mu   sync.Mutex
+	runs map[*sqlx.DB]*activeRun
+}
+
+type activeRun struct {
+	cancel  context.CancelFunc
+	tx      *sqlx.Tx
+	lockKey int64
+}
+
+// track registers the run using db; the returned context is cancelled when
+// the run is aborted
+func (m *Migrator) track(ctx context.Context, db *sqlx.DB) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	a := m.active
+	if a == nil {
+		return ctx, cancel
+	}
+	a.mu.Lock()
+	a.runs[db] = &activeRun{cancel: cancel, lockKey: m.AdvisoryLockKey()}
+	a.mu.Unlock()
+	return ctx, func() {
+		a.mu.Lock()
+		delete(a.runs, db)
+		a.mu.Unlock()
+		cancel()
+	}
+}
+
+// setActiveTx records the migration transaction currently open on db
+func (m *Migrator) setActiveTx(db *sqlx.DB, tx *sqlx.Tx) {
+	a := m.active
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	if run, ok := a.runs[db]; ok {
+		run.tx = tx
+	}
+	a.mu.Unlock()
+}
+
+// abort rolls back the open transaction and releases the advisory lock of
+// every run in flight
+func (a *activeRuns) abort() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for db, run := range a.runs {
+		run.cancel()
+		if run.tx != nil {
+			run.tx.Rollback()
+			run.tx = nil
+		}
+		db.Exec("SELECT pg_advisory_unlock($1)", run.lockKey)
+	}
+}
+
+// RollbackOnSignal makes runs of m started after this call abort when one
+// of signals is received: the open migration transaction is rolled back,
+// the advisory lock is released and the run returns a context.Canceled
+// error. Call it before Migrate and defer the returned function, which
+// stops listening:
+//
+//	defer m.RollbackOnSignal(syscall.SIGTERM, os.Interrupt)()
+//
+// While registered the signals no longer terminate the process by default;
+// the caller decides how to exit once Migrate returns.
+func (m *Migrator) RollbackOnSignal(signals ...os.Signal) func() {
+	if m.active == nil {
+		m.active = &activeRuns{runs: make(map[*sqlx.DB]*activeRun)}
+	}
+	a := m.active
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, signals...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				a.abort()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
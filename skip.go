@@ -0,0 +1,89 @@
+package pgmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// statusSkipped is the status of a migration retired with Skip. Rows with a
+// NULL status are applied.
+const statusSkipped = "skipped"
+
+// Skip records the migration id as intentionally skipped: runs neither apply
+// it nor count it as pending, and it is reported as StateSkipped. Use it to
+// retire a harmful migration on every database that hasn't run it yet while
+// keeping the file for those that have. The file doesn't need to exist.
+// Skipping an applied migration is an error; skipping it twice is not.
+func (m *Migrator) Skip(ctx context.Context, id string) error {
+	db, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.close(db)
+	if err := createMigrationsTableIfNotExists(db, m.Table); err != nil {
+		return err
+	}
+	status, found, err := m.trackedStatus(ctx, db, id)
+	if err != nil {
+		return err
+	}
+	if found {
+		if status != statusSkipped {
+			return fmt.Errorf("migration %s is already %s", id, status)
+		}
+		return nil
+	}
+	_, err = db.ExecContext(ctx, "INSERT INTO "+m.Table+
+		" (id, status, applied_at, applied_by) VALUES ($1, $2, now(), current_user)", id, statusSkipped)
+	return err
+}
+
+// Unskip reverts Skip: the migration id is pending again
+func (m *Migrator) Unskip(ctx context.Context, id string) error {
+	db, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.close(db)
+	res, err := db.ExecContext(ctx, "DELETE FROM "+m.Table+" WHERE id = $1 AND status = $2", id, statusSkipped)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("migration %s is not skipped", id)
+	}
+	return nil
+}
+
+// trackedStatus returns the status of the row of id in the migrations table,
+// "applied", statusSkipped or statusDirty; found is false without a row
+func (m *Migrator) trackedStatus(ctx context.Context, db *sqlx.DB, id string) (status string, found bool, err error) {
+	err = db.QueryRowxContext(ctx, "SELECT coalesce(status, 'applied') FROM "+m.Table+" WHERE id = $1", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("read status of %s: %w", id, err)
+	}
+	return status, true, nil
+}
+
+// trackedResult returns the result of a migration recorded in the migrations
+// table, or a zero Result when it is pending
+func (m *Migrator) trackedResult(ctx context.Context, db *sqlx.DB, id string) (Result, error) {
+	status, found, err := m.trackedStatus(ctx, db, id)
+	if err != nil || !found {
+		return Result{}, err
+	}
+	switch status {
+	case statusSkipped:
+		return Result{ID: id, State: StateSkipped}, nil
+	case statusDirty:
+		// partially applied: pending until its remaining phases ran
+		return Result{}, nil
+	}
+	return Result{ID: id, State: StateAlreadyApplied}, nil
+}
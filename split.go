@@ -0,0 +1,227 @@
+package pgmigrate
+
+import (
+	"strings"
+	"unicode"
+)
+
+// splitStatements splits sql into its individual statements on top-level
+// semicolons. Semicolons inside string literals, quoted identifiers,
+// dollar-quoted bodies and comments don't terminate a statement. Statements
+// consisting only of whitespace and comments are dropped, as is the inline
+// data of COPY ... FROM STDIN: see splitScript.
+func splitStatements(sql string) []string {
+	var stmts []string
+	for _, stmt := range splitScript(sql) {
+		stmts = append(stmts, stmt.SQL)
+	}
+	return stmts
+}
+
+// statement is a statement of a migration script
+type statement struct {
+	SQL     string
+	HasData bool     // COPY ... FROM STDIN followed by inline data
+	Rows    []string // its data lines, without the closing \.
+
+	Unterminated bool // last statement of the script, without semicolon
+}
+
+// splitScript splits sql like splitStatements. A COPY ... FROM STDIN
+// statement ending its line may be followed by data lines up to a line
+// consisting of \., as in pg_dump output; they are attached to it. A last
+// statement without semicolon is kept and marked Unterminated.
+func splitScript(sql string) []statement {
+	var (
+		stmts   []statement
+		start   int
+		content bool // current statement has more than comments
+	)
+	emit := func(end int) int {
+		if content {
+			stmt := statement{SQL: strings.TrimSpace(sql[start:end])}
+			if copySource(stmt.SQL) == "STDIN" {
+				if rows, next, ok := copyData(sql, end+1); ok {
+					stmt.HasData, stmt.Rows = true, rows
+					end = next - 1
+				}
+			}
+			stmts = append(stmts, stmt)
+		}
+		start = end + 1
+		content = false
+		return end
+	}
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			i = skipBlockComment(sql, i)
+		case c == '\'':
+			escapes := i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i < 2 || !isIdentByte(sql[i-2]))
+			i = skipQuoted(sql, i, '\'', escapes)
+			content = true
+		case c == '"':
+			i = skipQuoted(sql, i, '"', false)
+			content = true
+		case c == '$':
+			if tag := dollarTag(sql[i:]); tag != "" && (i == 0 || !isIdentByte(sql[i-1])) {
+				end := strings.Index(sql[i+len(tag):], tag)
+				if end < 0 {
+					i = len(sql)
+				} else {
+					i += len(tag) + end + len(tag) - 1
+				}
+			}
+			content = true
+		case c == ';':
+			i = emit(i)
+		case !unicode.IsSpace(rune(c)):
+			content = true
+		}
+	}
+	if start < len(sql) {
+		n := len(stmts)
+		emit(len(sql))
+		if len(stmts) > n && !stmts[n].HasData {
+			stmts[n].Unterminated = true
+		}
+	}
+	return stmts
+}
+
+// unterminated reports whether the last statement of sql has no semicolon,
+// which may mean the file was truncated. Trailing whitespace and comments
+// don't count as a statement.
+func unterminated(sql string) bool {
+	stmts := splitScript(sql)
+	return len(stmts) > 0 && stmts[len(stmts)-1].Unterminated
+}
+
+// copyData reads the inline data of a COPY ... FROM STDIN statement whose
+// terminating semicolon is right before from: the rest of that line must be
+// blank, then come the data lines up to a \. line. It returns the rows and
+// the offset following the \. line; ok is false without such data.
+func copyData(sql string, from int) (rows []string, next int, ok bool) {
+	if from > len(sql) {
+		return nil, 0, false
+	}
+	eol := strings.IndexByte(sql[from:], '\n')
+	if eol < 0 || strings.TrimSpace(sql[from:from+eol]) != "" {
+		return nil, 0, false
+	}
+	for i := from + eol + 1; i < len(sql); {
+		end := strings.IndexByte(sql[i:], '\n')
+		line := sql[i:]
+		next := len(sql)
+		if end >= 0 {
+			line = sql[i : i+end]
+			next = i + end + 1
+		}
+		line = strings.TrimSuffix(line, "\r")
+		if line == `\.` {
+			return rows, next, true
+		}
+		rows = append(rows, line)
+		i = next
+	}
+	return nil, 0, false
+}
+
+// skipBlockComment returns the index of the closing slash of the (possibly
+// nested) block comment starting at i
+func skipBlockComment(sql string, i int) int {
+	depth := 0
+	for ; i < len(sql)-1; i++ {
+		switch {
+		case sql[i] == '/' && sql[i+1] == '*':
+			depth++
+			i++
+		case sql[i] == '*' && sql[i+1] == '/':
+			depth--
+			i++
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(sql)
+}
+
+// skipQuoted returns the index of the quote closing the literal or
+// identifier starting at i. A doubled quote is an escaped quote; with
+// escapes a backslash escapes the next byte as in E'...' strings.
+func skipQuoted(sql string, i int, quote byte, escapes bool) int {
+	for i++; i < len(sql); i++ {
+		switch {
+		case escapes && sql[i] == '\\':
+			i++
+		case sql[i] == quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(sql)
+}
+
+// dollarTag returns the dollar-quote tag ($$ or $name$) s starts with, if any
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		if s[j] == '$' {
+			return s[:j+1]
+		}
+		if !isIdentByte(s[j]) || (j == 1 && s[j] >= '0' && s[j] <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// stripComments removes the leading comments and whitespace of stmt
+func stripComments(stmt string) string {
+	for {
+		stmt = strings.TrimSpace(stmt)
+		switch {
+		case strings.HasPrefix(stmt, "--"):
+			end := strings.IndexByte(stmt, '\n')
+			if end < 0 {
+				return ""
+			}
+			stmt = stmt[end:]
+		case strings.HasPrefix(stmt, "/*"):
+			end := skipBlockComment(stmt, 0)
+			if end >= len(stmt) {
+				return ""
+			}
+			stmt = stmt[end+1:]
+		default:
+			return stmt
+		}
+	}
+}
+
+// keywords returns the first n upper-cased words of stmt, ignoring comments
+func keywords(stmt string, n int) []string {
+	words := strings.Fields(stripComments(stmt))
+	if len(words) > n {
+		words = words[:n]
+	}
+	for i := range words {
+		words[i] = strings.ToUpper(words[i])
+	}
+	return words
+}
@@ -0,0 +1,61 @@
+package pgmigrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitScript(t *testing.T) {
+	tests := []struct {
+		name         string
+		sql          string
+		want         []string
+		unterminated bool
+	}{
+		{"terminated", "SELECT 1;\nSELECT 2;\n", []string{"SELECT 1", "SELECT 2"}, false},
+		{"no trailing semicolon", "SELECT 1;\nSELECT 2\n", []string{"SELECT 1", "SELECT 2"}, true},
+		{"trailing comment", "SELECT 1;\nSELECT 2; -- done\n", []string{"SELECT 1", "SELECT 2"}, false},
+		{"trailing block comment", "SELECT 1;\n/* done */\n", []string{"SELECT 1"}, false},
+		{"comment after unterminated", "SELECT 1;\nSELECT 2 -- done\n", []string{"SELECT 1", "SELECT 2 -- done"}, true},
+		{"semicolons quoted", "SELECT ';', \"a;b\", $$;$$, $f$;$f$;", []string{"SELECT ';', \"a;b\", $$;$$, $f$;$f$"}, false},
+		{"escape string", "SELECT E'\\';';\nSELECT 2;", []string{"SELECT E'\\';'", "SELECT 2"}, false},
+		{"function body", "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;", []string{"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql"}, false},
+		{"empty statements", ";;\n-- only a comment\n", nil, false},
+		{"copy data last", "COPY t FROM STDIN;\n1\n\\.\n", []string{"COPY t FROM STDIN"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmts := splitScript(tt.sql)
+			var got []string
+			for i, stmt := range stmts {
+				got = append(got, stmt.SQL)
+				if stmt.Unterminated && i != len(stmts)-1 {
+					t.Errorf("statement %d of %d marked unterminated", i+1, len(stmts))
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitScript = %q, want %q", got, tt.want)
+			}
+			if u := unterminated(tt.sql); u != tt.unterminated {
+				t.Errorf("unterminated = %v, want %v", u, tt.unterminated)
+			}
+			if len(stmts) > 0 && stmts[len(stmts)-1].Unterminated != tt.unterminated {
+				t.Errorf("last statement Unterminated = %v, want %v", !tt.unterminated, tt.unterminated)
+			}
+		})
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	tests := map[string]string{
+		"-- a\n/* b */ SELECT 1": "SELECT 1",
+		"SELECT 1 -- a":          "SELECT 1 -- a",
+		"-- only":                "",
+		"/* a /* nested */ */ X": "X",
+	}
+	for in, want := range tests {
+		if got := stripComments(in); got != want {
+			t.Errorf("stripComments(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
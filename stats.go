@@ -0,0 +1,95 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Stats summarizes the migration state of a database
+type Stats struct {
+	Applied       int       // migrations recorded as applied in the migrations table
+	Skipped       int       // migrations retired with Skip
+	Pending       int       // migrations on disk not applied yet
+	Dirty         bool      // an applied migration's file no longer matches its checksum, or a multi-phase migration was interrupted
+	LastAppliedAt time.Time // when the latest migration was applied, zero if unknown
+}
+
+// Stats compares the migrations table with MigrationDir
+func (m *Migrator) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	db, err := m.connect(ctx)
+	if err != nil {
+		return stats, err
+	}
+	defer m.close(db)
+	tracked, err := m.tracked(ctx, db)
+	if err != nil {
+		return stats, err
+	}
+	files, err := m.migrationFiles()
+	if err != nil {
+		return stats, err
+	}
+	for _, row := range tracked {
+		switch row.Status.String {
+		case statusSkipped:
+			stats.Skipped++
+			continue
+		case statusDirty:
+			stats.Dirty = true
+			continue
+		}
+		stats.Applied++
+		if row.AppliedAt.Valid && row.AppliedAt.Time.After(stats.LastAppliedAt) {
+			stats.LastAppliedAt = row.AppliedAt.Time
+		}
+	}
+	for _, file := range files {
+		if row, ok := tracked[m.migrationID(file)]; !ok || row.Status.String == statusDirty {
+			stats.Pending++
+		}
+	}
+	mismatches, err := m.checksumMismatches(tracked, files)
+	if err != nil {
+		return stats, err
+	}
+	stats.Dirty = stats.Dirty || len(mismatches) > 0
+	return stats, nil
+}
+
+// MetricsText returns Stats in the OpenMetrics text exposition format,
+// ready to be served from a /metrics endpoint. Metrics are labelled with
+// the migrations table.
+func (m *Migrator) MetricsText(ctx context.Context) (string, error) {
+	stats, err := m.Stats(ctx)
+	if err != nil {
+		return "", err
+	}
+	dirty := 0
+	if stats.Dirty {
+		dirty = 1
+	}
+	var lastApplied float64
+	if !stats.LastAppliedAt.IsZero() {
+		lastApplied = float64(stats.LastAppliedAt.UnixNano()) / 1e9
+	}
+	labels := `{table="` + escapeLabel(m.Table) + `"}`
+	var b strings.Builder
+	metric := func(name, help string, value interface{}) {
+		fmt.Fprintf(&b, "# TYPE %s gauge\n# HELP %s %s\n%s%s %v\n", name, name, help, name, labels, value)
+	}
+	metric("pgmigrate_migrations_applied", "Number of migrations recorded as applied.", stats.Applied)
+	metric("pgmigrate_migrations_pending", "Number of migrations not applied yet.", stats.Pending)
+	metric("pgmigrate_migrations_skipped", "Number of migrations retired without being applied.", stats.Skipped)
+	metric("pgmigrate_dirty", "1 if an applied migration no longer matches its file.", dirty)
+	metric("pgmigrate_last_applied_timestamp_seconds", "Unix time the latest migration was applied.", lastApplied)
+	b.WriteString("# EOF\n")
+	return b.String(), nil
+}
+
+// escapeLabel escapes a label value of the text exposition format
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
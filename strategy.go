@@ -0,0 +1,91 @@
+package pgmigrate
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Strategy selects which pending migrations a run applies. applied holds the
+// ids recorded in the migrations table and files the ids of the migrations
+// on disk in the order they run. Only the set of returned ids matters: they
+// are applied in the order of files whatever their order in the result, and
+// migrations not returned are left pending.
+type Strategy interface {
+	PendingMigrations(applied []string, files []string) []string
+}
+
+// ForwardStrategy applies every pending migration, the default
+type ForwardStrategy struct{}
+
+// PendingMigrations returns files not in applied
+func (ForwardStrategy) PendingMigrations(applied []string, files []string) []string {
+	done := make(map[string]bool, len(applied))
+	for _, id := range applied {
+		done[id] = true
+	}
+	var pending []string
+	for _, id := range files {
+		if !done[id] {
+			pending = append(pending, id)
+		}
+	}
+	return pending
+}
+
+// SingleStepStrategy applies only the next pending migration
+type SingleStepStrategy struct{}
+
+// PendingMigrations returns the first of files not in applied
+func (SingleStepStrategy) PendingMigrations(applied []string, files []string) []string {
+	pending := ForwardStrategy{}.PendingMigrations(applied, files)
+	if len(pending) > 1 {
+		pending = pending[:1]
+	}
+	return pending
+}
+
+// TargetStrategy applies the pending migrations up to and including Target.
+// Nothing is applied if Target is not among the migrations.
+type TargetStrategy struct {
+	Target string
+}
+
+// PendingMigrations returns the files up to Target not in applied
+func (s TargetStrategy) PendingMigrations(applied []string, files []string) []string {
+	for i, id := range files {
+		if id == s.Target {
+			return ForwardStrategy{}.PendingMigrations(applied, files[:i+1])
+		}
+	}
+	return nil
+}
+
+// selected returns the ids of files the Strategy picks, ForwardStrategy if
+// unset
+func (m *Migrator) selected(ctx context.Context, db *sqlx.DB, files []string) (map[string]bool, error) {
+	strategy := m.Strategy
+	if strategy == nil {
+		strategy = ForwardStrategy{}
+	}
+	tracked, err := m.tracked(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	applied := make([]string, 0, len(tracked))
+	for id, row := range tracked {
+		// dirty migrations are pending until their remaining phases ran
+		if row.Status.String != statusDirty {
+			applied = append(applied, id)
+		}
+	}
+	ids := make([]string, len(files))
+	for i, file := range files {
+		ids[i] = m.migrationID(file)
+	}
+	selected := make(map[string]bool)
+	for _, id := range strategy.PendingMigrations(applied, ids) {
+		selected[id] = true
+	}
+	return selected, nil
+}
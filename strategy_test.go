@@ -0,0 +1,26 @@
+package pgmigrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStrategies(t *testing.T) {
+	applied := []string{"1", "3"}
+	files := []string{"1", "2", "3", "4", "5"}
+	tests := []struct {
+		name     string
+		strategy Strategy
+		want     []string
+	}{
+		{"forward", ForwardStrategy{}, []string{"2", "4", "5"}},
+		{"single step", SingleStepStrategy{}, []string{"2"}},
+		{"target", TargetStrategy{Target: "4"}, []string{"2", "4"}},
+		{"unknown target", TargetStrategy{Target: "9"}, nil},
+	}
+	for _, tt := range tests {
+		if got := tt.strategy.PendingMigrations(applied, files); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
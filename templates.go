@@ -0,0 +1,169 @@
+package pgmigrate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// templatesDir is the subdirectory of MigrationDir holding the templates
+// saved with SaveMigrationTemplate; its files are not migrations
+const templatesDir = ".templates"
+
+// TemplateData is what migration templates are executed with
+type TemplateData struct {
+	ID        string // id the migration will be tracked under
+	Name      string // name given to CreateMigration or CreateMigrationFromTemplate
+	Timestamp string // timestamp of the file name, in RFC 3339 format
+	Up        string // up marker line, empty with MarkersGolangMigrate
+	Down      string // down marker line, empty with MarkersGolangMigrate
+}
+
+// builtinTemplates are the templates available to every Migrator. The down
+// part is only written when the marker style keeps it in the same file.
+var builtinTemplates = map[string]string{
+	"add-column": `-- pgmigrate: description: {{.Name}}
+{{with .Up}}{{.}}
+{{end}}ALTER TABLE table_name ADD COLUMN column_name text;
+{{with .Down}}
+{{.}}
+ALTER TABLE table_name DROP COLUMN column_name;
+{{end}}`,
+	"drop-column": `-- pgmigrate: description: {{.Name}}
+{{with .Up}}{{.}}
+{{end}}ALTER TABLE table_name DROP COLUMN column_name;
+{{with .Down}}
+{{.}}
+ALTER TABLE table_name ADD COLUMN column_name text;
+{{end}}`,
+	"create-table": `-- pgmigrate: description: {{.Name}}
+{{with .Up}}{{.}}
+{{end}}CREATE TABLE table_name (
+    id bigint GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+{{with .Down}}
+{{.}}
+DROP TABLE table_name;
+{{end}}`,
+	"create-index": `-- pgmigrate: description: {{.Name}}
+-- pgmigrate: no-transaction: true
+{{with .Up}}{{.}}
+{{end}}CREATE INDEX CONCURRENTLY IF NOT EXISTS table_name_column_name_idx ON table_name (column_name);
+{{with .Down}}
+{{.}}
+DROP INDEX CONCURRENTLY IF EXISTS table_name_column_name_idx;
+{{end}}`,
+}
+
+// RegisterTemplate adds a text/template migration template available to
+// CreateMigrationFromTemplate under name, replacing a built-in one of the
+// same name. It is executed with a TemplateData.
+func (m *Migrator) RegisterTemplate(name, tmpl string) error {
+	t, err := template.New(name).Parse(tmpl)
+	if err != nil {
+		return err
+	}
+	if m.templates == nil {
+		m.templates = make(map[string]*template.Template)
+	}
+	m.templates[name] = t
+	return nil
+}
+
+// SaveMigrationTemplate saves a text/template migration template to
+// <MigrationDir>/.templates/<name>.tmpl, so CreateMigrationFromTemplate
+// finds it in later processes too. It is parsed first: an invalid template
+// is not saved.
+func (m *Migrator) SaveMigrationTemplate(name, content string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid template name %q", name)
+	}
+	if _, err := template.New(name).Parse(content); err != nil {
+		return err
+	}
+	dir := filepath.Join(m.MigrationDir, templatesDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, name+".tmpl"), content)
+}
+
+// isSavedTemplate reports whether file is in the templates subdirectory
+func (m *Migrator) isSavedTemplate(file string) bool {
+	rel := strings.TrimPrefix(m.migrationID(file), m.MigrationIDPrefix+"/")
+	return strings.HasPrefix(rel, templatesDir+"/")
+}
+
+// CreateMigrationFromTemplate creates a migration called name scaffolded from
+// the template templateName: the one registered with RegisterTemplate,
+// otherwise the one saved with SaveMigrationTemplate, otherwise the built-in
+// one: add-column, drop-column, create-table or create-index.
+func (m *Migrator) CreateMigrationFromTemplate(name, templateName string) error {
+	t, err := m.template(templateName)
+	if err != nil {
+		return err
+	}
+	return m.createMigrationFromTemplate(name, t)
+}
+
+// createMigrationFromTemplate creates a migration called name with the
+// content of t
+func (m *Migrator) createMigrationFromTemplate(name string, t *template.Template) error {
+	path, err := m.newMigrationPath(name)
+	if err != nil {
+		return err
+	}
+	data := TemplateData{ID: m.migrationID(path), Name: name}
+	if stem, ok := m.timestampStem(filepath.Base(path)); ok {
+		data.Timestamp = strings.TrimPrefix(stem, m.MigrationIDPrefix+"_")
+	}
+	if m.MarkerStyle != MarkersGolangMigrate {
+		data.Up, data.Down = m.markers()
+	}
+	var content strings.Builder
+	if err := t.Execute(&content, data); err != nil {
+		return err
+	}
+	return writeMigration(path, content.String())
+}
+
+// fileTemplate returns the template configured with Template or
+// TemplateFile for CreateMigration, nil when there is none
+func (m *Migrator) fileTemplate() (*template.Template, error) {
+	if m.Template != "" {
+		return template.New("Template").Parse(m.Template)
+	}
+	if m.TemplateFile == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(m.TemplateFile)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(filepath.Base(m.TemplateFile)).Parse(string(content))
+}
+
+// template returns the template called name, looked up in the order of
+// CreateMigrationFromTemplate
+func (m *Migrator) template(name string) (*template.Template, error) {
+	if t, ok := m.templates[name]; ok {
+		return t, nil
+	}
+	saved, err := ioutil.ReadFile(filepath.Join(m.MigrationDir, templatesDir, name+".tmpl"))
+	if err == nil {
+		return template.New(name).Parse(string(saved))
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	tmpl, ok := builtinTemplates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown migration template %q", name)
+	}
+	return template.New(name).Parse(tmpl)
+}
@@ -0,0 +1,34 @@
+package pgmigrate
+
+import "context"
+
+// Tracer starts the spans of a run, e.g. by adapting an OpenTelemetry
+// tracer. Runs start a span named pgmigrate.migrate and, as its children,
+// pgmigrate.connect, pgmigrate.lock and one pgmigrate.migration per
+// migration, with the attributes migration.id and migration.state.
+type Tracer interface {
+	// StartSpan starts a span called name as a child of the span of ctx, if
+	// any, and returns a context carrying it
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer
+type Span interface {
+	SetAttribute(key, value string)
+	// End ends the span, failed when err is not nil
+	End(err error)
+}
+
+// noopSpan is the span of runs without Tracer
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key, value string) {}
+func (noopSpan) End(err error)                  {}
+
+// startSpan starts a span with Tracer, if set
+func (m *Migrator) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if m.Tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return m.Tracer.StartSpan(ctx, name)
+}
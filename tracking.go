@@ -0,0 +1,58 @@
+package pgmigrate
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// appliedIDs returns the ids recorded in the migrations table, which may not
+// exist yet
+func (m *Migrator) appliedIDs(ctx context.Context, db *sqlx.DB) (map[string]bool, error) {
+	var exists bool
+	if err := db.QueryRowxContext(ctx, "SELECT to_regclass($1) IS NOT NULL", m.Table).Scan(&exists); err != nil {
+		return nil, err
+	}
+	applied := make(map[string]bool)
+	if !exists {
+		return applied, nil
+	}
+	var ids []string
+	if err := db.SelectContext(ctx, &ids, "SELECT id FROM "+m.Table); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		applied[id] = true
+	}
+	return applied, nil
+}
+
+// trackedMigration is a row of the migrations table
+type trackedMigration struct {
+	ID        string         `db:"id"`
+	Checksum  sql.NullString `db:"checksum"`
+	AppliedAt sql.NullTime   `db:"applied_at"`
+	Status    sql.NullString `db:"status"`
+}
+
+// tracked returns the rows of the migrations table by id, or none if the
+// table doesn't exist yet
+func (m *Migrator) tracked(ctx context.Context, db *sqlx.DB) (map[string]trackedMigration, error) {
+	var exists bool
+	if err := db.QueryRowxContext(ctx, "SELECT to_regclass($1) IS NOT NULL", m.Table).Scan(&exists); err != nil {
+		return nil, err
+	}
+	rows := make(map[string]trackedMigration)
+	if !exists {
+		return rows, nil
+	}
+	var list []trackedMigration
+	if err := db.SelectContext(ctx, &list, "SELECT id, checksum, applied_at, status FROM "+m.Table); err != nil {
+		return nil, err
+	}
+	for _, row := range list {
+		rows[row.ID] = row
+	}
+	return rows, nil
+}
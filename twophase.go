@@ -0,0 +1,358 @@
+package pgmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// preparedPrefix starts the global id of the prepared transactions of
+// MigrateTwoPhase: pgmigrate_<run id>_<index of the migrator>
+const preparedPrefix = "pgmigrate_"
+
+// ErrPreparedTransactionsDisabled is returned by MigrateTwoPhase for a
+// database whose max_prepared_transactions is 0, the Postgres default
+var ErrPreparedTransactionsDisabled = errors.New("pgmigrate: prepared transactions are disabled, set max_prepared_transactions > 0")
+
+// InDoubtError is returned by MigrateTwoPhase when the migrations were
+// prepared on every database but could not be committed on some of them.
+// Their prepared transactions, listed in Prepared, keep their locks until
+// they are committed with ResolvePrepared.
+type InDoubtError struct {
+	Committed []int          // indexes of the migrators committed
+	Prepared  map[int]string // global id of the transactions left prepared, by index of migrator
+	Err       error          // the last commit error
+}
+
+func (e *InDoubtError) Error() string {
+	gids := make([]string, 0, len(e.Prepared))
+	for _, gid := range e.Prepared {
+		gids = append(gids, gid)
+	}
+	sort.Strings(gids)
+	return fmt.Sprintf("migrations in doubt: %d databases committed, prepared transactions %s left to commit: %v",
+		len(e.Committed), strings.Join(gids, ", "), e.Err)
+}
+
+func (e *InDoubtError) Unwrap() error {
+	return e.Err
+}
+
+// MigrateTwoPhase applies the pending migrations of several databases, one
+// Migrator each, so that they are applied on all of them or on none, with
+// a two-phase commit. The migrations of each database run in a single
+// transaction which is prepared (PREPARE TRANSACTION) once they all
+// succeeded; the prepared transactions are committed once every database
+// prepared its own, and rolled back if any failed before.
+//
+// Every database needs max_prepared_transactions > 0. Migrations with the
+// no-transaction header or phases can't be applied this way and fail the
+// run; repeatable migrations are not run, and the isolation header has no
+// effect. BeforeMigration is called with a nil transaction.
+//
+// Once every database prepared, the outcome is decided: commit failures are
+// retried on a new connection, and those that persist leave the migrations
+// in doubt, returned as an *InDoubtError. Until they are committed with
+// ResolvePrepared, the prepared transactions hold their locks, and the
+// next runs on their database fail.
+//
+// The results are returned in the order of migrators.
+func MigrateTwoPhase(ctx context.Context, migrators ...*Migrator) ([][]Result, error) {
+	runID, err := newRunID()
+	if err != nil {
+		return nil, err
+	}
+	dbs := make([]*sqlx.DB, len(migrators))
+	gids := make([]string, len(migrators))
+	results := make([][]Result, len(migrators))
+	defer func() {
+		for i, db := range dbs {
+			if db != nil {
+				migrators[i].releaseLock(db)
+				migrators[i].close(db)
+			}
+		}
+	}()
+	// rollback undoes the transactions prepared so far
+	rollback := func() {
+		for i, gid := range gids {
+			if gid == "" {
+				continue
+			}
+			if _, err := dbs[i].Exec("ROLLBACK PREPARED " + pq.QuoteLiteral(gid)); err != nil {
+				migrators[i].logf("warning: rolling back prepared transaction %s: %v", gid, err)
+			}
+		}
+	}
+
+	for i, m := range migrators {
+		db, err := m.connect(ctx)
+		if err != nil {
+			return results, migrationError(StageConnect, "", err)
+		}
+		if err := m.acquireLock(ctx, db); err != nil {
+			m.close(db)
+			return results, migrationError(StageLock, "", err)
+		}
+		dbs[i] = db
+	}
+	for i, m := range migrators {
+		if err := checkPreparedTransactions(ctx, dbs[i]); err != nil {
+			return results, migrationError(StageConnect, "", err)
+		}
+		if err := createMigrationsTableIfNotExists(dbs[i], m.Table); err != nil {
+			return results, migrationError(StageCreateTable, "", err)
+		}
+	}
+	for i, m := range migrators {
+		gid := fmt.Sprintf("%s%s_%d", preparedPrefix, runID, i)
+		results[i], err = m.prepareTwoPhase(ctx, dbs[i], runID, gid)
+		if err != nil {
+			rollback()
+			return results, err
+		}
+		gids[i] = gid
+	}
+
+	inDoubt := &InDoubtError{Prepared: make(map[int]string)}
+	for i, m := range migrators {
+		if err := m.commitPrepared(dbs[i], gids[i]); err != nil {
+			m.logf("warning: committing prepared transaction %s: %v", gids[i], err)
+			inDoubt.Prepared[i] = gids[i]
+			inDoubt.Err = err
+			continue
+		}
+		inDoubt.Committed = append(inDoubt.Committed, i)
+	}
+	if len(inDoubt.Prepared) > 0 {
+		return results, inDoubt
+	}
+	for i, m := range migrators {
+		if m.AfterMigration == nil {
+			continue
+		}
+		for _, result := range results[i] {
+			if result.State != StateApplied {
+				continue
+			}
+			if err := m.AfterMigration(ctx, result); err != nil {
+				return results, migrationError(StageExec, result.ID, err)
+			}
+		}
+	}
+	return results, nil
+}
+
+// checkPreparedTransactions fails when the database can't prepare
+// transactions or still has prepared transactions of an earlier
+// MigrateTwoPhase
+func checkPreparedTransactions(ctx context.Context, db *sqlx.DB) error {
+	var max int
+	if err := db.QueryRowxContext(ctx, "SELECT current_setting('max_prepared_transactions')::int").Scan(&max); err != nil {
+		return err
+	}
+	if max == 0 {
+		return ErrPreparedTransactionsDisabled
+	}
+	gids, err := preparedTransactions(ctx, db)
+	if err != nil {
+		return err
+	}
+	if len(gids) > 0 {
+		return fmt.Errorf("prepared transactions %s of an earlier run are in doubt: see ResolvePrepared", strings.Join(gids, ", "))
+	}
+	return nil
+}
+
+// preparedTransactions returns the global ids of the transactions prepared
+// by MigrateTwoPhase in the current database
+func preparedTransactions(ctx context.Context, db *sqlx.DB) ([]string, error) {
+	var gids []string
+	err := db.SelectContext(ctx, &gids, `SELECT gid FROM pg_prepared_xacts
+		WHERE database = current_database() AND left(gid, length($1)) = $1 ORDER BY prepared`, preparedPrefix)
+	return gids, err
+}
+
+// prepareTwoPhase applies the pending migrations in a single transaction and
+// prepares it as gid. The transaction is rolled back when that fails.
+func (m *Migrator) prepareTwoPhase(ctx context.Context, db *sqlx.DB, runID, gid string) ([]Result, error) {
+	files, err := m.migrationFiles()
+	if err != nil {
+		return nil, migrationError(StageRead, "", err)
+	}
+	path, err := newSessionPath(ctx, db)
+	if err != nil {
+		return nil, migrationError(StageConnect, "", err)
+	}
+	if path.tracked, err = m.tracked(ctx, db); err != nil {
+		return nil, migrationError(StageRead, "", err)
+	}
+	selected, err := m.selected(ctx, db, files)
+	if err != nil {
+		return nil, migrationError(StageRead, "", err)
+	}
+	// the pool holds a single connection, so the statements below all run
+	// in the transaction begun here
+	if _, err := db.ExecContext(ctx, "BEGIN"); err != nil {
+		return nil, migrationError(StageExec, "", err)
+	}
+	if err := m.setLocalSession(ctx, db); err != nil {
+		db.Exec("ROLLBACK")
+		return nil, migrationError(StageExec, "", err)
+	}
+	results, err := m.applyTwoPhase(ctx, db, files, selected, path, runID)
+	if err == nil {
+		if _, err = db.ExecContext(ctx, "PREPARE TRANSACTION "+pq.QuoteLiteral(gid)); err != nil {
+			err = migrationError(StageTrack, "", err)
+		}
+	}
+	if err != nil {
+		db.Exec("ROLLBACK")
+		return results, err
+	}
+	return results, nil
+}
+
+// applyTwoPhase runs and records the selected pending migrations of files
+// in the transaction open on db
+func (m *Migrator) applyTwoPhase(ctx context.Context, db *sqlx.DB, files []string, selected map[string]bool, path *sessionPath, runID string) ([]Result, error) {
+	// a single transaction: the tracking row is written with the SQL
+	local := *m
+	local.TrackingOrder = TrackAfter
+	var results []Result
+	for _, file := range files {
+		id := m.migrationID(file)
+		if tracked, ok := path.applied(id); ok {
+			results = append(results, tracked)
+			continue
+		}
+		if err := m.useSearchPath(ctx, db, file, path); err != nil {
+			return results, migrationError(StageExec, id, err)
+		}
+		tracked, err := m.trackedResult(ctx, db, id)
+		if err != nil {
+			return results, migrationError(StageRead, id, err)
+		}
+		if tracked.ID != "" {
+			results = append(results, tracked)
+			continue
+		}
+		if !selected[id] {
+			continue
+		}
+		content, err := m.readMigration(file)
+		if err != nil {
+			return results, migrationError(StageRead, id, err)
+		}
+		header, err := ParseMigrationHeader(content)
+		if err != nil {
+			return results, migrationError(StageRead, id, err)
+		}
+		list, err := phases(m.upSQL(content))
+		if err != nil {
+			return results, migrationError(StageRead, id, err)
+		}
+		if header.NoTransaction || list != nil {
+			return results, migrationError(StageRead, id, errors.New("migrations outside a single transaction can't be applied with MigrateTwoPhase"))
+		}
+		if err := m.checkDependsOn(ctx, db, id, header.DependsOn); err != nil {
+			return results, migrationError(StageVerify, id, err)
+		}
+		// the transaction is shared: the settings are put back for the
+		// migrations after this one
+		restore, err := setHeaderSettings(ctx, db, header, true)
+		if err != nil {
+			return results, migrationError(StageExec, id, err)
+		}
+		if m.BeforeMigration != nil {
+			if err := m.BeforeMigration(ctx, nil, id); err != nil {
+				return results, migrationError(StageExec, id, err)
+			}
+		}
+		state, unmet, err := checkConditions(ctx, db, header)
+		if err != nil {
+			return results, migrationError(StageExec, id, err)
+		}
+		if unmet {
+			restore()
+			results = append(results, Result{ID: id, State: state})
+			continue
+		}
+		start := time.Now()
+		rows, err := m.execSQL(ctx, db, m.upSQL(content), m.SplitStatements)
+		if err != nil {
+			return results, migrationError(StageExec, id, err)
+		}
+		if err := local.recordDone(ctx, db, id, content, runID, time.Since(start)); err != nil {
+			return results, migrationError(StageTrack, id, err)
+		}
+		restore()
+		path.forget()
+		results = append(results, Result{ID: id, State: StateApplied, RowsAffected: rows})
+	}
+	return results, nil
+}
+
+// commitPrepared commits the prepared transaction gid. A failed commit may
+// still have happened, e.g. when the connection broke on its way back, so
+// it is looked up on a new connection and committed again if still
+// prepared, up to three times a second apart. The outcome being decided,
+// it doesn't use the run's context.
+func (m *Migrator) commitPrepared(db *sqlx.DB, gid string) error {
+	ctx := context.Background()
+	commit := "COMMIT PREPARED " + pq.QuoteLiteral(gid)
+	_, err := db.Exec(commit)
+	for attempt := 0; err != nil && attempt < 3; attempt++ {
+		time.Sleep(time.Second)
+		err = func() error {
+			retry, err := m.connect(ctx)
+			if err != nil {
+				return err
+			}
+			defer m.close(retry)
+			var prepared bool
+			err = retry.QueryRowxContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_prepared_xacts WHERE gid = $1)", gid).Scan(&prepared)
+			if err != nil || !prepared {
+				return err
+			}
+			_, err = retry.Exec(commit)
+			return err
+		}()
+	}
+	return err
+}
+
+// ResolvePrepared ends the prepared transactions MigrateTwoPhase left in
+// the database, committing them when commit is set and rolling them back
+// otherwise, and returns their global ids. After an *InDoubtError, commit
+// them: the other databases committed or are in doubt too. Transactions
+// left by a crash before the commit of every database started are only
+// safe to commit when each database of the run has its own; their global
+// id ends with the index of the migrator.
+func (m *Migrator) ResolvePrepared(ctx context.Context, commit bool) ([]string, error) {
+	db, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close(db)
+	gids, err := preparedTransactions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	end := "ROLLBACK PREPARED "
+	if commit {
+		end = "COMMIT PREPARED "
+	}
+	for i, gid := range gids {
+		if _, err := db.ExecContext(ctx, end+pq.QuoteLiteral(gid)); err != nil {
+			return gids[:i], err
+		}
+	}
+	return gids, nil
+}
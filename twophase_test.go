@@ -0,0 +1,62 @@
+package pgmigrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMigrateTwoPhaseRestoresHeaderSettings(t *testing.T) {
+	role := fmt.Sprintf("pgmigrate_test_%d", time.Now().UnixNano())
+	m := testMigrator(t, map[string]string{
+		"0001_as_role.pgsql": "-- pgmigrate: role: " + role + "\n-- pgmigrate: lock-timeout: 1234ms\nCREATE TABLE owned (id int);\n",
+		"0002_plain.pgsql":   "CREATE TABLE settings AS SELECT current_user::text AS role, current_setting('lock_timeout') AS lock_timeout;\n",
+	})
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.close(db)
+	// the role creates a table and records the migration in the schema
+	if err := createMigrationsTableIfNotExists(db, m.Table); err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"CREATE ROLE " + role,
+		"GRANT " + role + " TO current_user",
+		"GRANT ALL ON SCHEMA " + m.Schema + " TO " + role,
+		"GRANT ALL ON " + m.Table + " TO " + role,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Skipf("%s: %v", stmt, err)
+		}
+	}
+	defer db.Exec("DROP OWNED BY " + role + "; DROP ROLE " + role)
+
+	_, err = MigrateTwoPhase(ctx, m)
+	if errors.Is(err, ErrPreparedTransactionsDisabled) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var owner, current, lockTimeout string
+	if err := db.QueryRowx("SELECT tableowner FROM pg_tables WHERE schemaname = $1 AND tablename = 'owned'", m.Schema).Scan(&owner); err != nil {
+		t.Fatal(err)
+	}
+	if owner != role {
+		t.Errorf("owned table owned by %s, want %s", owner, role)
+	}
+	if err := db.QueryRowx("SELECT role, lock_timeout FROM settings").Scan(&current, &lockTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if current == role {
+		t.Errorf("second migration ran as %s, the role of the first", current)
+	}
+	if lockTimeout == "1234ms" {
+		t.Errorf("second migration ran with the lock_timeout of the first")
+	}
+}
@@ -0,0 +1,83 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ValidationReport is the outcome of ValidateOnTemplate
+type ValidationReport struct {
+	Database string        // temporary database the migrations ran in
+	Results  []Result      // as returned by MigrateResults on the clone
+	Duration time.Duration // time spent applying the migrations
+	Err      error         // why the migrations failed, nil on success
+}
+
+// ValidateOnTemplate runs the pending migrations against a throwaway clone
+// of TemplateDB instead of the database itself: it creates a temporary
+// database with CREATE DATABASE ... TEMPLATE, migrates it and drops it again,
+// also when the migrations fail. The connection of Conn is used to create
+// and drop the clone, so its role needs the CREATEDB privilege, and Postgres
+// refuses to copy a template that has other sessions connected.
+//
+// The returned error reports a failure to set up the clone; a failure of the
+// migrations themselves is in the report's Err.
+func (m *Migrator) ValidateOnTemplate(ctx context.Context) (ValidationReport, error) {
+	var report ValidationReport
+	if m.TemplateDB == "" {
+		return report, fmt.Errorf("TemplateDB is not set")
+	}
+	db, err := m.connect(ctx)
+	if err != nil {
+		return report, err
+	}
+	defer m.close(db)
+
+	var canCreate bool
+	err = db.QueryRowxContext(ctx, "SELECT rolcreatedb OR rolsuper FROM pg_roles WHERE rolname = current_user").Scan(&canCreate)
+	if err != nil {
+		return report, err
+	}
+	if !canCreate {
+		return report, fmt.Errorf("validate on template %s: the current role lacks the CREATEDB privilege", m.TemplateDB)
+	}
+
+	suffix, err := newRunID()
+	if err != nil {
+		return report, err
+	}
+	report.Database = "pgmigrate_validate_" + suffix
+	_, err = db.ExecContext(ctx, "CREATE DATABASE "+pq.QuoteIdentifier(report.Database)+" TEMPLATE "+pq.QuoteIdentifier(m.TemplateDB))
+	if err != nil {
+		return report, fmt.Errorf("clone %s: %w", m.TemplateDB, err)
+	}
+	defer func() {
+		// ctx may be done by now; the clone must go regardless
+		if _, err := db.Exec("DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(report.Database)); err != nil {
+			m.logf("warning: drop validation database %s: %v", report.Database, err)
+		}
+	}()
+
+	dsn, err := m.dsn()
+	if err != nil {
+		return report, err
+	}
+	params, err := parseDSN(dsn)
+	if err != nil {
+		return report, err
+	}
+	params["dbname"] = report.Database
+	clone := *m
+	clone.Conn = formatDSN(params)
+	clone.DB = nil
+	clone.UseService = false
+	clone.CacheTTL = 0
+
+	start := time.Now()
+	report.Results, report.Err = clone.MigrateResults(ctx)
+	report.Duration = time.Since(start)
+	return report, nil
+}
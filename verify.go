@@ -0,0 +1,125 @@
+package pgmigrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChecksumPolicy decides what a run does when applied migrations no longer
+// match the checksum recorded when they were applied
+type ChecksumPolicy int
+
+// Supported checksum policies
+const (
+	ChecksumIgnore ChecksumPolicy = iota // don't compare checksums
+	ChecksumWarn                         // log every mismatch and proceed
+	ChecksumFail                         // fail the run before applying anything
+)
+
+// ChecksumMismatch is an applied migration whose file changed since
+type ChecksumMismatch struct {
+	ID       string
+	Stored   string // checksum recorded when it was applied
+	Computed string // checksum of the file on disk, ChecksumMissing without file
+}
+
+// ChecksumMissing is the Computed checksum reported by ValidateChecksums for
+// applied migrations whose file no longer exists
+const ChecksumMissing = "MISSING"
+
+func (c ChecksumMismatch) String() string {
+	return fmt.Sprintf("migration %s: checksum %s, applied as %s", c.ID, c.Computed, c.Stored)
+}
+
+// ChecksumError lists the mismatches that failed a run under ChecksumFail
+type ChecksumError struct {
+	Mismatches []ChecksumMismatch
+}
+
+func (e *ChecksumError) Error() string {
+	msgs := make([]string, len(e.Mismatches))
+	for i, c := range e.Mismatches {
+		msgs[i] = c.String()
+	}
+	return "applied migrations changed: " + strings.Join(msgs, "; ")
+}
+
+// Verify compares the checksums recorded in the migrations table with the
+// files in MigrationDir and returns every applied migration that changed.
+// Migrations recorded without a checksum are not reported.
+func (m *Migrator) Verify(ctx context.Context) ([]ChecksumMismatch, error) {
+	db, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close(db)
+	tracked, err := m.tracked(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	files, err := m.migrationFiles()
+	if err != nil {
+		return nil, err
+	}
+	return m.checksumMismatches(tracked, files)
+}
+
+// ValidateChecksums is like Verify but also reports applied migrations whose
+// file is gone, with ChecksumMissing as Computed, to check a whole migration
+// set before a deploy. Pending migrations are not reported.
+func (m *Migrator) ValidateChecksums() ([]ChecksumMismatch, error) {
+	ctx := context.Background()
+	db, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close(db)
+	tracked, err := m.tracked(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	files, err := m.migrationFiles()
+	if err != nil {
+		return nil, err
+	}
+	mismatches, err := m.checksumMismatches(tracked, files)
+	if err != nil {
+		return nil, err
+	}
+	onDisk := make(map[string]bool, len(files))
+	for _, file := range files {
+		onDisk[m.migrationID(file)] = true
+	}
+	var missing []ChecksumMismatch
+	for id, row := range tracked {
+		if row.Checksum.Valid && !onDisk[id] {
+			missing = append(missing, ChecksumMismatch{ID: id, Stored: row.Checksum.String, Computed: ChecksumMissing})
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].ID < missing[j].ID })
+	return append(mismatches, missing...), nil
+}
+
+// checksumMismatches returns the files among files whose tracked checksum
+// differs from their content. Dirty migrations are left to applyPhases,
+// which accepts a changed file while none of its phases is recorded.
+func (m *Migrator) checksumMismatches(tracked map[string]trackedMigration, files []string) ([]ChecksumMismatch, error) {
+	var mismatches []ChecksumMismatch
+	for _, file := range files {
+		id := m.migrationID(file)
+		row, ok := tracked[id]
+		if !ok || !row.Checksum.Valid || row.Status.String == statusDirty {
+			continue
+		}
+		sum, ok, err := m.checksumMatches(row.Checksum.String, file)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			mismatches = append(mismatches, ChecksumMismatch{ID: id, Stored: row.Checksum.String, Computed: sum})
+		}
+	}
+	return mismatches, nil
+}